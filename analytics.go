@@ -0,0 +1,3147 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minStdDev is the smallest spread we treat as meaningful. Below it every
+// song is effectively at the mean and z-scores would just amplify noise.
+const minStdDev = 1e-9
+
+// StreamOutliers returns songs whose stream count sits more than threshold
+// standard deviations above the catalog mean, along with their z-scores.
+func (p *PrestoClient) StreamOutliers(ctx context.Context, threshold float64) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	mean, stddev := meanStdDev(len(p.songs), func(i int) float64 {
+		return float64(p.songs[i].Streams)
+	})
+
+	rows := make([][]interface{}, 0)
+	if stddev >= minStdDev {
+		outliers := make([]Song, 0)
+		for _, song := range p.songs {
+			if (float64(song.Streams)-mean)/stddev > threshold {
+				outliers = append(outliers, song)
+			}
+		}
+
+		sort.SliceStable(outliers, func(i, j int) bool {
+			return outliers[i].Streams > outliers[j].Streams
+		})
+
+		for _, song := range outliers {
+			rows = append(rows, []interface{}{
+				song.ID,
+				song.AlbumID,
+				song.Title,
+				song.Streams,
+				roundTo((float64(song.Streams)-mean)/stddev, 3),
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"mean_streams":   roundTo(mean, 2),
+		"stddev_streams": roundTo(stddev, 2),
+		"threshold":      threshold,
+		"sample_size":    len(p.songs),
+		"columns":        []string{"id", "album_id", "title", "streams_millions", "z_score"},
+		"rows":           rows,
+		"row_count":      len(rows),
+	}, nil
+}
+
+// meanStdDev computes the mean and population standard deviation of n
+// values produced by value.
+func meanStdDev(n int, value func(i int) float64) (float64, float64) {
+	if n == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += value(i)
+	}
+	mean := sum / float64(n)
+
+	var sq float64
+	for i := 0; i < n; i++ {
+		d := value(i) - mean
+		sq += d * d
+	}
+
+	return mean, math.Sqrt(sq / float64(n))
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// SongsInEras returns songs whose album belongs to one of eras, grouped by
+// era in the order requested. Era names match case-insensitively.
+func (p *PrestoClient) SongsInEras(ctx context.Context, eras []string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	selected := make([]string, 0, len(eras))
+	seen := make(map[string]bool)
+	for _, era := range eras {
+		name, ok := p.resolveEra(era)
+		if !ok {
+			unknown = append(unknown, era)
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			selected = append(selected, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, &ArgumentError{
+			Argument: "eras",
+			Message: fmt.Sprintf("unknown eras: %s (valid eras: %s)",
+				strings.Join(unknown, ", "), strings.Join(p.knownEras(), ", ")),
+			Value:        unknown,
+			ValidOptions: p.knownEras(),
+		}
+	}
+
+	albums := p.albumIndex()
+	grouped := make(map[string][]map[string]interface{}, len(selected))
+	total := 0
+	for _, song := range p.songs {
+		album, ok := albums[song.AlbumID]
+		if !ok || !seen[album.Era] {
+			continue
+		}
+		grouped[album.Era] = append(grouped[album.Era], map[string]interface{}{
+			"id":               song.ID,
+			"title":            song.Title,
+			"album_id":         album.ID,
+			"album_title":      album.Title,
+			"streams_millions": song.Streams,
+			"chart_peak":       song.ChartPeak,
+		})
+		total++
+	}
+
+	groups := make([]map[string]interface{}, 0, len(selected))
+	for _, era := range selected {
+		songs := grouped[era]
+		if songs == nil {
+			songs = []map[string]interface{}{}
+		}
+		groups = append(groups, map[string]interface{}{
+			"era":        era,
+			"songs":      songs,
+			"song_count": len(songs),
+		})
+	}
+
+	return map[string]interface{}{
+		"eras":        groups,
+		"total_songs": total,
+	}, nil
+}
+
+// resolveEra matches name case-insensitively against the known eras and
+// returns the canonical spelling.
+func (p *PrestoClient) resolveEra(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	for _, era := range p.knownEras() {
+		if strings.EqualFold(era, name) {
+			return era, true
+		}
+	}
+	return "", false
+}
+
+// unknownEraError reports an era argument that matched no album.
+func (p *PrestoClient) unknownEraError(argument, era string) error {
+	return &ArgumentError{
+		Argument: argument,
+		Message: fmt.Sprintf("unknown era %q (valid eras: %s)",
+			era, strings.Join(p.knownEras(), ", ")),
+		Value:        era,
+		ValidOptions: p.knownEras(),
+	}
+}
+
+// albumIndex maps album IDs to albums for joining songs to their album.
+func (p *PrestoClient) albumIndex() map[string]Album {
+	index := make(map[string]Album, len(p.albums))
+	for _, album := range p.albums {
+		index[album.ID] = album
+	}
+	return index
+}
+
+// knownEras lists the distinct album eras in catalog order.
+func (p *PrestoClient) knownEras() []string {
+	seen := make(map[string]bool)
+	eras := make([]string, 0)
+	for _, album := range p.albums {
+		if !seen[album.Era] {
+			seen[album.Era] = true
+			eras = append(eras, album.Era)
+		}
+	}
+	return eras
+}
+
+// TourProjection fits a linear trend to revenue per attendee across tours and
+// projects revenue for a hypothetical tour of the given attendance in year.
+// A zero year projects for the year after the most recent tour; a year
+// before the first tour is rejected.
+func (p *PrestoClient) TourProjection(ctx context.Context, attendance int64, year int) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+	if len(p.tours) < 2 {
+		return nil, fmt.Errorf("need at least two tours to fit a trend, have %d", len(p.tours))
+	}
+
+	xs := make([]float64, 0, len(p.tours))
+	ys := make([]float64, 0, len(p.tours))
+	rates := make([]map[string]interface{}, 0, len(p.tours))
+	latest, earliest := 0, math.MaxInt
+	for _, tour := range p.tours {
+		if tour.Year < earliest {
+			earliest = tour.Year
+		}
+		if tour.Attendance <= 0 {
+			continue
+		}
+		rate := tour.Revenue * 1e6 / float64(tour.Attendance)
+		xs = append(xs, float64(tour.Year))
+		ys = append(ys, rate)
+		rates = append(rates, map[string]interface{}{
+			"tour":                 tour.Name,
+			"year":                 tour.Year,
+			"revenue_per_attendee": roundTo(rate, 2),
+		})
+		if tour.Year > latest {
+			latest = tour.Year
+		}
+	}
+
+	slope, intercept, ok := linearFit(xs, ys)
+	if !ok {
+		return nil, fmt.Errorf("tour years do not vary enough to fit a trend")
+	}
+
+	if year == 0 {
+		year = latest + 1
+	}
+	if year < earliest {
+		return nil, &ArgumentError{
+			Argument: "year",
+			Message:  fmt.Sprintf("year must not be before the first tour (%d)", earliest),
+			Value:    year,
+		}
+	}
+	projectedRate := slope*float64(year) + intercept
+	if projectedRate < 0 {
+		projectedRate = 0
+	}
+
+	return map[string]interface{}{
+		"attendance":                     attendance,
+		"year":                           year,
+		"projected_revenue_per_attendee": roundTo(projectedRate, 2),
+		"projected_revenue_millions":     roundTo(projectedRate*float64(attendance)/1e6, 1),
+		"trend_per_year":                 roundTo(slope, 2),
+		"historical_rates":               rates,
+		"caveat": fmt.Sprintf("Linear extrapolation from %d tours; ignores venue mix, "+
+			"pricing strategy, and inflation, so treat as a rough estimate only.", len(rates)),
+	}, nil
+}
+
+// linearFit returns the least-squares slope and intercept of ys over xs. It
+// reports false when xs has no variance.
+func linearFit(xs, ys []float64) (float64, float64, bool) {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0, 0, false
+	}
+
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX float64
+	for i := range xs {
+		dx := xs[i] - meanX
+		cov += dx * (ys[i] - meanY)
+		varX += dx * dx
+	}
+	if varX == 0 {
+		return 0, 0, false
+	}
+
+	slope := cov / varX
+	return slope, meanY - slope*meanX, true
+}
+
+// SongsPerYear counts songs by their album's release year. Years with albums
+// but no songs in the dataset are reported with a zero count.
+func (p *PrestoClient) SongsPerYear(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int)
+	for _, album := range p.albums {
+		if _, ok := counts[album.ReleaseYear]; !ok {
+			counts[album.ReleaseYear] = 0
+		}
+	}
+
+	albums := p.albumIndex()
+	for _, song := range p.songs {
+		if album, ok := albums[song.AlbumID]; ok {
+			counts[album.ReleaseYear]++
+		}
+	}
+
+	years := make([]int, 0, len(counts))
+	for year := range counts {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+
+	rows := make([][]interface{}, 0, len(years))
+	for _, year := range years {
+		rows = append(rows, []interface{}{year, counts[year]})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"year", "song_count"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// hitChartPeak is the worst chart position that still counts as a hit.
+const hitChartPeak = 10
+
+// AlbumCard builds a single-object summary of an album: its metadata, song
+// and stream totals, hit and grammy counts, and its sales rank.
+func (p *PrestoClient) AlbumCard(ctx context.Context, albumID string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albumID = strings.ToUpper(albumID)
+	album, ok := p.albumIndex()[albumID]
+	if !ok {
+		return nil, &ArgumentError{
+			Argument: "album_id",
+			Message:  fmt.Sprintf("album not found: %s", albumID),
+			Value:    albumID,
+		}
+	}
+
+	var songCount, hits, grammyNoms int
+	var totalStreams int64
+	for _, song := range p.songs {
+		if song.AlbumID != album.ID {
+			continue
+		}
+		songCount++
+		totalStreams += song.Streams
+		grammyNoms += song.GrammyNoms
+		if song.ChartPeak > 0 && song.ChartPeak <= hitChartPeak {
+			hits++
+		}
+	}
+
+	avgStreams := float64(0)
+	if songCount > 0 {
+		avgStreams = float64(totalStreams) / float64(songCount)
+	}
+
+	// Albums tied on sales share a rank.
+	rank := 1
+	for _, other := range p.albums {
+		if other.Sales > album.Sales {
+			rank++
+		}
+	}
+
+	return map[string]interface{}{
+		"album":                  album,
+		"song_count":             songCount,
+		"total_streams_millions": totalStreams,
+		"avg_streams_millions":   roundTo(avgStreams, 1),
+		"hits":                   hits,
+		"grammy_nominations":     grammyNoms,
+		"sales_rank":             rank,
+		"album_count":            len(p.albums),
+	}, nil
+}
+
+// AlbumsWithCounts returns every album with a derived song_count column.
+// Albums without songs in the dataset report zero rather than being dropped.
+func (p *PrestoClient) AlbumsWithCounts(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := p.songCounts()
+	rows := make([][]interface{}, 0, len(p.albums))
+	for _, album := range p.albums {
+		rows = append(rows, []interface{}{
+			album.ID,
+			album.Title,
+			album.ReleaseYear,
+			album.Era,
+			album.Sales,
+			album.Genre,
+			counts[album.ID],
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"id", "title", "release_year", "era", "sales_millions", "genre", "song_count"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// songCounts counts songs per album ID.
+func (p *PrestoClient) songCounts() map[string]int {
+	counts := make(map[string]int, len(p.albums))
+	for _, song := range p.songs {
+		counts[song.AlbumID]++
+	}
+	return counts
+}
+
+// ChartSpread reports, per album, the gap between its best and worst charting
+// song. Albums with fewer than two charting songs get a nil spread and sort
+// last.
+func (p *PrestoClient) ChartSpread(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type spread struct {
+		album       Album
+		best, worst int
+		charting    int
+	}
+
+	spreads := make([]*spread, 0, len(p.albums))
+	byID := make(map[string]*spread, len(p.albums))
+	for _, album := range p.albums {
+		sp := &spread{album: album}
+		spreads = append(spreads, sp)
+		byID[album.ID] = sp
+	}
+
+	for _, song := range p.songs {
+		sp, ok := byID[song.AlbumID]
+		if !ok || song.ChartPeak <= 0 {
+			continue
+		}
+		if sp.charting == 0 || song.ChartPeak < sp.best {
+			sp.best = song.ChartPeak
+		}
+		if song.ChartPeak > sp.worst {
+			sp.worst = song.ChartPeak
+		}
+		sp.charting++
+	}
+
+	sort.SliceStable(spreads, func(i, j int) bool {
+		a, b := spreads[i], spreads[j]
+		if (a.charting >= 2) != (b.charting >= 2) {
+			return a.charting >= 2
+		}
+		return a.worst-a.best < b.worst-b.best
+	})
+
+	rows := make([][]interface{}, 0, len(spreads))
+	for _, sp := range spreads {
+		var best, worst, gap interface{}
+		if sp.charting > 0 {
+			best, worst = sp.best, sp.worst
+		}
+		if sp.charting >= 2 {
+			gap = sp.worst - sp.best
+		}
+		rows = append(rows, []interface{}{
+			sp.album.ID,
+			sp.album.Title,
+			sp.charting,
+			best,
+			worst,
+			gap,
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"album_id", "title", "charting_songs", "best_peak", "worst_peak", "spread"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// maxMomentum caps streams-per-year so a brand-new release with a big debut
+// doesn't dwarf the rest of the catalog.
+const maxMomentum = 1000.0
+
+// StreamingMomentum ranks songs by streams per year since their album's
+// release, as of currentYear. Release years are counted inclusively, so a
+// song released this year has one year and never divides by zero; the
+// years_counted column is that divisor.
+func (p *PrestoClient) StreamingMomentum(ctx context.Context, currentYear int) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type momentum struct {
+		song  Song
+		album Album
+		years int
+		value float64
+	}
+
+	albums := p.albumIndex()
+	ranked := make([]momentum, 0, len(p.songs))
+	for _, song := range p.songs {
+		album, ok := albums[song.AlbumID]
+		if !ok {
+			continue
+		}
+		years := currentYear - album.ReleaseYear + 1
+		if years < 1 {
+			years = 1
+		}
+		ranked = append(ranked, momentum{
+			song:  song,
+			album: album,
+			years: years,
+			value: math.Min(float64(song.Streams)/float64(years), maxMomentum),
+		})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].value > ranked[j].value
+	})
+
+	rows := make([][]interface{}, 0, len(ranked))
+	for _, m := range ranked {
+		rows = append(rows, []interface{}{
+			m.song.ID,
+			m.song.Title,
+			m.album.Title,
+			m.album.ReleaseYear,
+			m.song.Streams,
+			m.years,
+			roundTo(m.value, 1),
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"song_id", "title", "album_title", "release_year", "streams_millions", "years_counted", "streams_per_year"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// songNumericColumns maps sortable numeric song columns to their values.
+var songNumericColumns = map[string]func(Song) float64{
+	"duration_seconds":   func(s Song) float64 { return float64(s.Duration) },
+	"streams_millions":   func(s Song) float64 { return float64(s.Streams) },
+	"chart_peak":         func(s Song) float64 { return float64(s.ChartPeak) },
+	"grammy_nominations": func(s Song) float64 { return float64(s.GrammyNoms) },
+}
+
+// songNumericColumnNames lists songNumericColumns in a stable order for
+// error messages and schemas.
+func songNumericColumnNames() []string {
+	names := make([]string, 0, len(songNumericColumns))
+	for name := range songNumericColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortSongs returns every song sorted by a numeric column, with its album
+// title joined in. Ties go to the lowest song ID.
+func (p *PrestoClient) SortSongs(ctx context.Context, column string, descending bool) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	value, ok := songNumericColumns[column]
+	if !ok {
+		return nil, &ArgumentError{
+			Argument: "column",
+			Message: fmt.Sprintf("unknown sort column %q (valid columns: %s)",
+				column, strings.Join(songNumericColumnNames(), ", ")),
+			Value:        column,
+			ValidOptions: songNumericColumnNames(),
+		}
+	}
+
+	songs := make([]Song, len(p.songs))
+	copy(songs, p.songs)
+	sort.SliceStable(songs, func(i, j int) bool {
+		if a, b := value(songs[i]), value(songs[j]); a != b {
+			return (a < b) != descending
+		}
+		return songs[i].ID < songs[j].ID
+	})
+
+	albums := p.albumIndex()
+	rows := make([][]interface{}, 0, len(songs))
+	for _, song := range songs {
+		rows = append(rows, []interface{}{
+			song.ID,
+			song.AlbumID,
+			albums[song.AlbumID].Title,
+			song.Title,
+			song.Duration,
+			song.Streams,
+			song.ChartPeak,
+			song.GrammyNoms,
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"id", "album_id", "album_title", "title", "duration_seconds", "streams_millions", "chart_peak", "grammy_nominations"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// EraOverview groups albums by era with each era's total sales and its
+// best-selling album as the representative, biggest eras first.
+func (p *PrestoClient) EraOverview(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type era struct {
+		name           string
+		albums         []Album
+		sales          int64
+		representative Album
+	}
+
+	eras := make([]*era, 0)
+	byName := make(map[string]*era)
+	for _, album := range p.albums {
+		e, ok := byName[album.Era]
+		if !ok {
+			e = &era{name: album.Era, representative: album}
+			byName[album.Era] = e
+			eras = append(eras, e)
+		}
+		e.albums = append(e.albums, album)
+		e.sales += album.Sales
+		if album.Sales > e.representative.Sales {
+			e.representative = album
+		}
+	}
+
+	sort.SliceStable(eras, func(i, j int) bool {
+		return eras[i].sales > eras[j].sales
+	})
+
+	overview := make([]map[string]interface{}, 0, len(eras))
+	for _, e := range eras {
+		overview = append(overview, map[string]interface{}{
+			"era":                  e.name,
+			"album_count":          len(e.albums),
+			"albums":               e.albums,
+			"total_sales_millions": e.sales,
+			"representative":       e.representative,
+		})
+	}
+
+	return map[string]interface{}{
+		"eras":      overview,
+		"era_count": len(overview),
+	}, nil
+}
+
+// MostProlificAlbum returns the album(s) with the most songs in the dataset.
+// Every album tied for the top count is included.
+func (p *PrestoClient) MostProlificAlbum(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := p.songCounts()
+	most := 0
+	for _, album := range p.albums {
+		if counts[album.ID] > most {
+			most = counts[album.ID]
+		}
+	}
+
+	rows := make([][]interface{}, 0)
+	if most > 0 {
+		for _, album := range p.albums {
+			if counts[album.ID] == most {
+				rows = append(rows, []interface{}{
+					album.ID,
+					album.Title,
+					album.Era,
+					album.ReleaseYear,
+					most,
+				})
+			}
+		}
+	}
+
+	return &QueryResult{
+		Columns:  []string{"album_id", "title", "era", "release_year", "song_count"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// DurationStreamCorrelation computes the Pearson correlation between song
+// duration and streams. With no variance in either column the coefficient
+// is undefined and reported as nil.
+func (p *PrestoClient) DurationStreamCorrelation(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	n := len(p.songs)
+	meanDur, sdDur := meanStdDev(n, func(i int) float64 { return float64(p.songs[i].Duration) })
+	meanStr, sdStr := meanStdDev(n, func(i int) float64 { return float64(p.songs[i].Streams) })
+
+	result := map[string]interface{}{
+		"sample_size":           n,
+		"mean_duration_seconds": roundTo(meanDur, 1),
+		"mean_streams_millions": roundTo(meanStr, 1),
+	}
+
+	if n < 2 || sdDur < minStdDev || sdStr < minStdDev {
+		result["coefficient"] = nil
+		result["interpretation"] = "Not enough variation in durations or streams to measure a correlation."
+		return result, nil
+	}
+
+	var cov float64
+	for _, song := range p.songs {
+		cov += (float64(song.Duration) - meanDur) * (float64(song.Streams) - meanStr)
+	}
+	r := cov / float64(n) / (sdDur * sdStr)
+
+	result["coefficient"] = roundTo(r, 3)
+	result["interpretation"] = interpretCorrelation(r)
+	return result, nil
+}
+
+// interpretCorrelation describes a Pearson coefficient in plain language.
+func interpretCorrelation(r float64) string {
+	strength := "no meaningful"
+	switch abs := math.Abs(r); {
+	case abs >= 0.7:
+		strength = "a strong"
+	case abs >= 0.4:
+		strength = "a moderate"
+	case abs >= 0.2:
+		strength = "a weak"
+	}
+
+	if strength == "no meaningful" {
+		return "There is no meaningful relationship between song length and streams."
+	}
+	if r > 0 {
+		return fmt.Sprintf("There is %s positive relationship: longer songs tend to get more streams.", strength)
+	}
+	return fmt.Sprintf("There is %s negative relationship: shorter songs tend to get more streams.", strength)
+}
+
+// tourAlbum finds the album a tour was named after by matching the album
+// title as whole words in the tour name ("The 1989 World Tour" -> "1989").
+// The longest matching title wins so multi-word titles beat shorter ones.
+func (p *PrestoClient) tourAlbum(tour Tour) (Album, bool) {
+	name := " " + strings.ToLower(tour.Name) + " "
+
+	var match Album
+	found := false
+	for _, album := range p.albums {
+		title := " " + strings.ToLower(album.Title) + " "
+		if strings.Contains(name, title) && (!found || len(album.Title) > len(match.Title)) {
+			match = album
+			found = true
+		}
+	}
+	return match, found
+}
+
+// ToursWithAlbums returns each tour alongside the album it promoted. Tours
+// without a clear album match have nil album fields.
+func (p *PrestoClient) ToursWithAlbums(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]interface{}, 0, len(p.tours))
+	for _, tour := range p.tours {
+		row := []interface{}{
+			tour.ID,
+			tour.Name,
+			tour.Year,
+			tour.Shows,
+			tour.Attendance,
+			tour.Revenue,
+			nil, nil, nil, nil,
+		}
+		if album, ok := p.tourAlbum(tour); ok {
+			row[6], row[7], row[8], row[9] = album.ID, album.Title, album.ReleaseYear, album.Sales
+		}
+		rows = append(rows, row)
+	}
+
+	return &QueryResult{
+		Columns: []string{"id", "name", "year", "shows", "attendance", "revenue_millions",
+			"album_id", "album_title", "album_release_year", "album_sales_millions"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// StreamConcentration computes the Gini coefficient of song streams (0 means
+// streams are spread evenly, values near 1 mean a few hits dominate) and the
+// share of all streams held by the top 20% of songs.
+func (p *PrestoClient) StreamConcentration(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	streams := make([]float64, 0, len(p.songs))
+	var total float64
+	for _, song := range p.songs {
+		streams = append(streams, float64(song.Streams))
+		total += float64(song.Streams)
+	}
+
+	n := len(streams)
+	if n == 0 || total == 0 {
+		return map[string]interface{}{
+			"sample_size":     n,
+			"gini":            nil,
+			"top_20pct_share": nil,
+		}, nil
+	}
+
+	// Gini over values sorted ascending with 1-based ranks:
+	// G = 2*sum(i*x_i) / (n*sum(x)) - (n+1)/n
+	sort.Float64s(streams)
+	var weighted float64
+	for i, x := range streams {
+		weighted += float64(i+1) * x
+	}
+	gini := 2*weighted/(float64(n)*total) - float64(n+1)/float64(n)
+
+	top := int(math.Ceil(float64(n) * 0.2))
+	var topStreams float64
+	for _, x := range streams[n-top:] {
+		topStreams += x
+	}
+
+	return map[string]interface{}{
+		"sample_size":            n,
+		"total_streams_millions": total,
+		"gini":                   roundTo(gini, 3),
+		"top_20pct_song_count":   top,
+		"top_20pct_share":        roundTo(topStreams/total, 3),
+	}, nil
+}
+
+// albumStats aggregates an album's songs.
+type albumStats struct {
+	songCount    int
+	totalStreams int64
+	grammyNoms   int
+	hits         int
+}
+
+// albumStatsByID aggregates songs per album ID in a single pass.
+func (p *PrestoClient) albumStatsByID() map[string]albumStats {
+	stats := make(map[string]albumStats, len(p.albums))
+	for _, song := range p.songs {
+		st := stats[song.AlbumID]
+		st.songCount++
+		st.totalStreams += song.Streams
+		st.grammyNoms += song.GrammyNoms
+		if song.ChartPeak > 0 && song.ChartPeak <= hitChartPeak {
+			st.hits++
+		}
+		stats[song.AlbumID] = st
+	}
+	return stats
+}
+
+// albumRankMetrics are the metrics rank_albums accepts. song_count and
+// total_streams are derived from each album's songs.
+var albumRankMetrics = map[string]func(Album, albumStats) float64{
+	"sales_millions": func(a Album, _ albumStats) float64 { return float64(a.Sales) },
+	"release_year":   func(a Album, _ albumStats) float64 { return float64(a.ReleaseYear) },
+	"song_count":     func(_ Album, st albumStats) float64 { return float64(st.songCount) },
+	"total_streams":  func(_ Album, st albumStats) float64 { return float64(st.totalStreams) },
+}
+
+func albumRankMetricNames() []string {
+	names := make([]string, 0, len(albumRankMetrics))
+	for name := range albumRankMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RankAlbums ranks every album by metric. Ties keep catalog order.
+func (p *PrestoClient) RankAlbums(ctx context.Context, metric string, descending bool) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	value, ok := albumRankMetrics[metric]
+	if !ok {
+		return nil, &ArgumentError{
+			Argument: "metric",
+			Message: fmt.Sprintf("unknown metric %q (valid metrics: %s)",
+				metric, strings.Join(albumRankMetricNames(), ", ")),
+			Value:        metric,
+			ValidOptions: albumRankMetricNames(),
+		}
+	}
+
+	stats := p.albumStatsByID()
+	albums := make([]Album, len(p.albums))
+	copy(albums, p.albums)
+	sort.SliceStable(albums, func(i, j int) bool {
+		a, b := value(albums[i], stats[albums[i].ID]), value(albums[j], stats[albums[j].ID])
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+
+	rows := make([][]interface{}, 0, len(albums))
+	for i, album := range albums {
+		st := stats[album.ID]
+		rows = append(rows, []interface{}{
+			i + 1,
+			album.ID,
+			album.Title,
+			album.ReleaseYear,
+			album.Era,
+			album.Sales,
+			st.songCount,
+			st.totalStreams,
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"rank", "id", "title", "release_year", "era", "sales_millions", "song_count", "total_streams_millions"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// EraProfile gathers everything about one era: its albums with their songs,
+// sales, stream and hit totals, and any tours named after its albums.
+func (p *PrestoClient) EraProfile(ctx context.Context, era string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	name, ok := p.resolveEra(era)
+	if !ok {
+		return nil, p.unknownEraError("era", era)
+	}
+
+	stats := p.albumStatsByID()
+	albums := make([]map[string]interface{}, 0)
+	inEra := make(map[string]bool)
+	var sales, streams int64
+	var hits, songCount int
+	for _, album := range p.albums {
+		if album.Era != name {
+			continue
+		}
+		inEra[album.ID] = true
+
+		songs := make([]Song, 0)
+		for _, song := range p.songs {
+			if song.AlbumID == album.ID {
+				songs = append(songs, song)
+			}
+		}
+
+		st := stats[album.ID]
+		sales += album.Sales
+		streams += st.totalStreams
+		hits += st.hits
+		songCount += st.songCount
+		albums = append(albums, map[string]interface{}{
+			"album":                  album,
+			"songs":                  songs,
+			"total_streams_millions": st.totalStreams,
+		})
+	}
+
+	tours := make([]Tour, 0)
+	for _, tour := range p.tours {
+		if album, ok := p.tourAlbum(tour); ok && inEra[album.ID] {
+			tours = append(tours, tour)
+		}
+	}
+
+	return map[string]interface{}{
+		"era":                    name,
+		"albums":                 albums,
+		"album_count":            len(albums),
+		"song_count":             songCount,
+		"total_sales_millions":   sales,
+		"total_streams_millions": streams,
+		"hits":                   hits,
+		"tours":                  tours,
+	}, nil
+}
+
+// GrammyEfficiency compares average grammy nominations for songs that
+// charted at or above threshold against those that didn't. Averages for an
+// empty group are nil.
+func (p *PrestoClient) GrammyEfficiency(ctx context.Context, threshold int) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	var chartingNoms, otherNoms, charting, other int
+	for _, song := range p.songs {
+		if song.ChartPeak > 0 && song.ChartPeak <= threshold {
+			charting++
+			chartingNoms += song.GrammyNoms
+		} else {
+			other++
+			otherNoms += song.GrammyNoms
+		}
+	}
+
+	average := func(noms, n int) interface{} {
+		if n == 0 {
+			return nil
+		}
+		return roundTo(float64(noms)/float64(n), 3)
+	}
+
+	return map[string]interface{}{
+		"chart_threshold": threshold,
+		"charting": map[string]interface{}{
+			"sample_size":       charting,
+			"avg_grammy_noms":   average(chartingNoms, charting),
+			"total_grammy_noms": chartingNoms,
+		},
+		"non_charting": map[string]interface{}{
+			"sample_size":       other,
+			"avg_grammy_noms":   average(otherNoms, other),
+			"total_grammy_noms": otherNoms,
+		},
+	}, nil
+}
+
+// chronologicalAlbums returns albums ordered by release year, breaking
+// same-year ties by ID so the order is deterministic.
+func (p *PrestoClient) chronologicalAlbums() []Album {
+	albums := make([]Album, len(p.albums))
+	copy(albums, p.albums)
+	sort.SliceStable(albums, func(i, j int) bool {
+		if albums[i].ReleaseYear != albums[j].ReleaseYear {
+			return albums[i].ReleaseYear < albums[j].ReleaseYear
+		}
+		return albums[i].ID < albums[j].ID
+	})
+	return albums
+}
+
+// AlbumNeighbors returns the albums released immediately before and after
+// albumID. Either neighbor is nil at the ends of the discography.
+func (p *PrestoClient) AlbumNeighbors(ctx context.Context, albumID string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albumID = strings.ToUpper(albumID)
+	albums := p.chronologicalAlbums()
+	for i, album := range albums {
+		if album.ID != albumID {
+			continue
+		}
+
+		var previous, next *Album
+		if i > 0 {
+			previous = &albums[i-1]
+		}
+		if i < len(albums)-1 {
+			next = &albums[i+1]
+		}
+
+		return map[string]interface{}{
+			"album":    album,
+			"previous": previous,
+			"next":     next,
+			"position": i + 1,
+			"of":       len(albums),
+		}, nil
+	}
+
+	return nil, &ArgumentError{
+		Argument: "album_id",
+		Message:  fmt.Sprintf("album not found: %s", albumID),
+		Value:    albumID,
+	}
+}
+
+// chronologicalSongs returns songs ordered by their album's release order,
+// then by song ID within an album.
+func (p *PrestoClient) chronologicalSongs() []Song {
+	order := make(map[string]int, len(p.albums))
+	for i, album := range p.chronologicalAlbums() {
+		order[album.ID] = i
+	}
+
+	songs := make([]Song, len(p.songs))
+	copy(songs, p.songs)
+	sort.SliceStable(songs, func(i, j int) bool {
+		oi, oj := order[songs[i].AlbumID], order[songs[j].AlbumID]
+		if oi != oj {
+			return oi < oj
+		}
+		return songs[i].ID < songs[j].ID
+	})
+	return songs
+}
+
+// ChartStreaks finds the longest run of consecutive #1 songs in release
+// order. The earliest streak wins ties.
+func (p *PrestoClient) ChartStreaks(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	songs := p.chronologicalSongs()
+	bestStart, bestLen := 0, 0
+	runStart, runLen := 0, 0
+	numberOnes := 0
+	for i, song := range songs {
+		if song.ChartPeak != 1 {
+			runLen = 0
+			continue
+		}
+		numberOnes++
+		if runLen == 0 {
+			runStart = i
+		}
+		runLen++
+		if runLen > bestLen {
+			bestStart, bestLen = runStart, runLen
+		}
+	}
+
+	albums := p.albumIndex()
+	streak := make([]map[string]interface{}, 0, bestLen)
+	for _, song := range songs[bestStart : bestStart+bestLen] {
+		album := albums[song.AlbumID]
+		streak = append(streak, map[string]interface{}{
+			"id":           song.ID,
+			"title":        song.Title,
+			"album_title":  album.Title,
+			"release_year": album.ReleaseYear,
+		})
+	}
+
+	result := map[string]interface{}{
+		"streak_length":   bestLen,
+		"songs":           streak,
+		"number_one_hits": numberOnes,
+	}
+	if bestLen == 0 {
+		result["note"] = "No songs in the dataset peaked at #1"
+	}
+	return result, nil
+}
+
+// SalesWeightedEra computes the sales-weighted average release year, the
+// "center of mass" of album sales, alongside the plain average.
+func (p *PrestoClient) SalesWeightedEra(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	var totalSales int64
+	var weighted, years float64
+	for _, album := range p.albums {
+		totalSales += album.Sales
+		weighted += float64(album.ReleaseYear) * float64(album.Sales)
+		years += float64(album.ReleaseYear)
+	}
+
+	result := map[string]interface{}{
+		"album_count":          len(p.albums),
+		"total_sales_millions": totalSales,
+		"weighted_year":        nil,
+		"unweighted_year":      nil,
+	}
+	if len(p.albums) > 0 {
+		result["unweighted_year"] = roundTo(years/float64(len(p.albums)), 1)
+	}
+	if totalSales > 0 {
+		result["weighted_year"] = roundTo(weighted/float64(totalSales), 1)
+	}
+	return result, nil
+}
+
+// AdvancedSongSearch applies every set filter with AND semantics and returns
+// the matching songs with album title and era, sorted by sortBy ("title" or
+// any numeric song column).
+func (p *PrestoClient) AdvancedSongSearch(ctx context.Context, filter SongFilter, sortBy string, descending bool) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	if filter.Era != "" {
+		era, ok := p.resolveEra(filter.Era)
+		if !ok {
+			return nil, p.unknownEraError("era", filter.Era)
+		}
+		filter.Era = era
+	}
+
+	sortOptions := append([]string{"title"}, songNumericColumnNames()...)
+	value, numeric := songNumericColumns[sortBy]
+	if !numeric && sortBy != "title" {
+		return nil, &ArgumentError{
+			Argument: "sort_by",
+			Message: fmt.Sprintf("unknown sort column %q (valid columns: %s)",
+				sortBy, strings.Join(sortOptions, ", ")),
+			Value:        sortBy,
+			ValidOptions: sortOptions,
+		}
+	}
+
+	albums := p.albumIndex()
+	if filter.AlbumID != "" {
+		filter.AlbumID = strings.ToUpper(filter.AlbumID)
+		if _, ok := albums[filter.AlbumID]; !ok {
+			return nil, &ArgumentError{
+				Argument: "album_id",
+				Message:  fmt.Sprintf("album not found: %s", filter.AlbumID),
+				Value:    filter.AlbumID,
+			}
+		}
+	}
+
+	songs := make([]Song, 0)
+	for _, song := range p.songs {
+		if filter.matches(song, albums) {
+			songs = append(songs, song)
+		}
+	}
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		if numeric {
+			if a, b := value(songs[i]), value(songs[j]); a != b {
+				return (a < b) != descending
+			}
+		} else {
+			if ta, tb := strings.ToLower(songs[i].Title), strings.ToLower(songs[j].Title); ta != tb {
+				return (ta < tb) != descending
+			}
+		}
+		return songs[i].ID < songs[j].ID
+	})
+
+	rows := make([][]interface{}, 0, len(songs))
+	for _, song := range songs {
+		album := albums[song.AlbumID]
+		rows = append(rows, []interface{}{
+			song.ID,
+			song.Title,
+			song.AlbumID,
+			album.Title,
+			album.Era,
+			song.Duration,
+			song.Streams,
+			song.ChartPeak,
+			song.GrammyNoms,
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"id", "title", "album_id", "album_title", "era", "duration_seconds", "streams_millions", "chart_peak", "grammy_nominations"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// TourVsSales compares each tour's revenue with the sales of the album it
+// promoted, as revenue per album sale (both in millions). Tours without an
+// album match, or whose album has no sales, are left out.
+func (p *PrestoClient) TourVsSales(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type pair struct {
+		tour  Tour
+		album Album
+		ratio float64
+	}
+
+	pairs := make([]pair, 0, len(p.tours))
+	for _, tour := range p.tours {
+		album, ok := p.tourAlbum(tour)
+		if !ok || album.Sales == 0 {
+			continue
+		}
+		pairs = append(pairs, pair{tour, album, tour.Revenue / float64(album.Sales)})
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		if pairs[i].ratio == pairs[j].ratio {
+			return pairs[i].tour.ID < pairs[j].tour.ID
+		}
+		return pairs[i].ratio > pairs[j].ratio
+	})
+
+	rows := make([][]interface{}, 0, len(pairs))
+	for _, pr := range pairs {
+		rows = append(rows, []interface{}{
+			pr.tour.Name,
+			pr.album.Title,
+			pr.album.Era,
+			pr.album.Sales,
+			pr.tour.Revenue,
+			roundTo(pr.ratio, 2),
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"tour_name", "album_title", "era", "album_sales_millions", "tour_revenue_millions", "revenue_per_sale"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// StreamsMovingAverage sums song streams per album in release order and
+// computes a trailing moving average over window albums. Albums before the
+// first full window have a null average.
+func (p *PrestoClient) StreamsMovingAverage(ctx context.Context, window int) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albums := p.chronologicalAlbums()
+	if window < 1 || window > len(albums) {
+		return nil, &ArgumentError{
+			Argument: "window",
+			Message:  fmt.Sprintf("window must be between 1 and %d (the album count)", len(albums)),
+			Value:    window,
+		}
+	}
+
+	stats := p.albumStatsByID()
+	rows := make([][]interface{}, 0, len(albums))
+	var windowSum int64
+	for i, album := range albums {
+		total := stats[album.ID].totalStreams
+		windowSum += total
+		if i >= window {
+			windowSum -= stats[albums[i-window].ID].totalStreams
+		}
+
+		var avg interface{}
+		if i >= window-1 {
+			avg = roundTo(float64(windowSum)/float64(window), 1)
+		}
+		rows = append(rows, []interface{}{album.ID, album.Title, album.ReleaseYear, total, avg})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"album_id", "title", "release_year", "total_streams_millions", "moving_avg_streams_millions"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// datasetChecksum hashes the loaded albums, songs and tours. Each table is
+// sorted by ID first, so the checksum depends only on the data, not on the
+// order it was loaded in.
+func (p *PrestoClient) datasetChecksum() (string, error) {
+	albums := make([]Album, len(p.albums))
+	copy(albums, p.albums)
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+
+	songs := make([]Song, len(p.songs))
+	copy(songs, p.songs)
+	sort.Slice(songs, func(i, j int) bool { return songs[i].ID < songs[j].ID })
+
+	tours := make([]Tour, len(p.tours))
+	copy(tours, p.tours)
+	sort.Slice(tours, func(i, j int) bool { return tours[i].ID < tours[j].ID })
+
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, table := range []interface{}{albums, songs, tours} {
+		if err := enc.Encode(table); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DataVersion identifies the loaded dataset so clients can tell whether a
+// cached copy is stale. The version is a prefix of the checksum and changes
+// whenever the data does.
+func (p *PrestoClient) DataVersion(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	checksum, err := p.datasetChecksum()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"version":   checksum[:12],
+		"checksum":  "sha256:" + checksum,
+		"loaded_at": p.loadedAt.UTC().Format(time.RFC3339),
+		"row_counts": map[string]int{
+			"albums": len(p.albums),
+			"songs":  len(p.songs),
+			"tours":  len(p.tours),
+		},
+	}, nil
+}
+
+// PerAlbumAverages divides career totals by the album count to describe a
+// "typical" album. Songs only count when they join to a known album. With no
+// albums every average is null.
+func (p *PrestoClient) PerAlbumAverages(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albums := p.albumIndex()
+
+	var totalSales int64
+	for _, album := range albums {
+		totalSales += album.Sales
+	}
+
+	var songCount, grammyNoms int
+	var totalStreams int64
+	for _, song := range p.songs {
+		if _, ok := albums[song.AlbumID]; !ok {
+			continue
+		}
+		songCount++
+		totalStreams += song.Streams
+		grammyNoms += song.GrammyNoms
+	}
+
+	result := map[string]interface{}{
+		"album_count":              len(albums),
+		"avg_sales_millions":       nil,
+		"avg_songs":                nil,
+		"avg_streams_millions":     nil,
+		"avg_grammy_nominations":   nil,
+		"total_sales_millions":     totalSales,
+		"total_songs":              songCount,
+		"total_streams_millions":   totalStreams,
+		"total_grammy_nominations": grammyNoms,
+	}
+	if n := float64(len(albums)); n > 0 {
+		result["avg_sales_millions"] = roundTo(float64(totalSales)/n, 2)
+		result["avg_songs"] = roundTo(float64(songCount)/n, 2)
+		result["avg_streams_millions"] = roundTo(float64(totalStreams)/n, 2)
+		result["avg_grammy_nominations"] = roundTo(float64(grammyNoms)/n, 2)
+	}
+	return result, nil
+}
+
+// PremiumTour ranks tours by revenue per attendee, in dollars (revenue is
+// stored in millions). Tours with no recorded attendance can't be ranked and
+// are listed separately. The top tour is null when nothing can be ranked.
+func (p *PrestoClient) PremiumTour(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type ranked struct {
+		tour      Tour
+		perPerson float64
+	}
+
+	var ranking []ranked
+	unranked := make([]string, 0)
+	for _, tour := range p.tours {
+		if tour.Attendance <= 0 {
+			unranked = append(unranked, tour.Name)
+			continue
+		}
+		ranking = append(ranking, ranked{tour, tour.Revenue * 1e6 / float64(tour.Attendance)})
+	}
+
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if ranking[i].perPerson == ranking[j].perPerson {
+			return ranking[i].tour.ID < ranking[j].tour.ID
+		}
+		return ranking[i].perPerson > ranking[j].perPerson
+	})
+
+	rows := make([]map[string]interface{}, 0, len(ranking))
+	for i, r := range ranking {
+		rows = append(rows, map[string]interface{}{
+			"rank":                     i + 1,
+			"tour_id":                  r.tour.ID,
+			"name":                     r.tour.Name,
+			"year":                     r.tour.Year,
+			"revenue_millions":         r.tour.Revenue,
+			"attendance":               r.tour.Attendance,
+			"revenue_per_attendee_usd": roundTo(r.perPerson, 2),
+		})
+	}
+
+	var top interface{}
+	if len(rows) > 0 {
+		top = rows[0]
+	}
+
+	return map[string]interface{}{
+		"premium_tour":           top,
+		"ranking":                rows,
+		"row_count":              len(rows),
+		"unranked_no_attendance": unranked,
+	}, nil
+}
+
+// GenreCatalog groups albums by genre (not era), listing each genre's
+// albums in release order with its total sales. Genres are sorted by total
+// sales, highest first.
+func (p *PrestoClient) GenreCatalog(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type genreGroup struct {
+		name   string
+		sales  int64
+		albums []map[string]interface{}
+	}
+
+	groups := make(map[string]*genreGroup)
+	var order []string
+	for _, album := range p.chronologicalAlbums() {
+		g, ok := groups[album.Genre]
+		if !ok {
+			g = &genreGroup{name: album.Genre}
+			groups[album.Genre] = g
+			order = append(order, album.Genre)
+		}
+		g.sales += album.Sales
+		g.albums = append(g.albums, map[string]interface{}{
+			"album_id":       album.ID,
+			"title":          album.Title,
+			"release_year":   album.ReleaseYear,
+			"era":            album.Era,
+			"sales_millions": album.Sales,
+		})
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := groups[order[i]], groups[order[j]]
+		if a.sales != b.sales {
+			return a.sales > b.sales
+		}
+		return a.name < b.name
+	})
+
+	genres := make([]map[string]interface{}, 0, len(order))
+	for _, name := range order {
+		g := groups[name]
+		genres = append(genres, map[string]interface{}{
+			"genre":                name,
+			"total_sales_millions": g.sales,
+			"album_count":          len(g.albums),
+			"albums":               g.albums,
+		})
+	}
+
+	return map[string]interface{}{
+		"genres":    genres,
+		"row_count": len(genres),
+	}, nil
+}
+
+// Hit-probability model. The score is a weighted sum of three features, each
+// scaled to 0-1, so the weights should add up to 1.
+const (
+	hitWeightStreams  = 0.5
+	hitWeightDuration = 0.2
+	hitWeightGrammys  = 0.3
+
+	// Songs inside the sweet spot get full duration credit; credit falls off
+	// linearly to zero over hitDurationFalloff seconds outside it.
+	hitDurationSweetMin = 180
+	hitDurationSweetMax = 240
+	hitDurationFalloff  = 60
+
+	// Nominations at or above this count get full Grammy credit
+	hitGrammyCap = 3
+)
+
+// HitProbability scores how "hit-like" a song is on a 0-1 scale from its
+// streams (relative to the most-streamed song), duration and Grammy
+// nominations. It is a heuristic for exploration, not a trained model.
+func (p *PrestoClient) HitProbability(ctx context.Context, songID string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	var song Song
+	var found bool
+	var maxStreams int64
+	for _, s := range p.songs {
+		if s.ID == songID {
+			song, found = s, true
+		}
+		if s.Streams > maxStreams {
+			maxStreams = s.Streams
+		}
+	}
+	if !found {
+		return nil, &ArgumentError{
+			Argument: "song_id",
+			Message:  fmt.Sprintf("song not found: %s", songID),
+			Value:    songID,
+		}
+	}
+
+	var streamScore float64
+	if maxStreams > 0 {
+		streamScore = float64(song.Streams) / float64(maxStreams)
+	}
+
+	durationScore := 1.0
+	switch {
+	case song.Duration < hitDurationSweetMin:
+		durationScore = 1 - float64(hitDurationSweetMin-song.Duration)/hitDurationFalloff
+	case song.Duration > hitDurationSweetMax:
+		durationScore = 1 - float64(song.Duration-hitDurationSweetMax)/hitDurationFalloff
+	}
+	durationScore = math.Max(durationScore, 0)
+
+	grammyScore := math.Min(float64(song.GrammyNoms)/hitGrammyCap, 1)
+
+	feature := func(value interface{}, score, weight float64) map[string]interface{} {
+		return map[string]interface{}{
+			"value":        value,
+			"score":        roundTo(score, 3),
+			"weight":       weight,
+			"contribution": roundTo(score*weight, 3),
+		}
+	}
+
+	total := streamScore*hitWeightStreams + durationScore*hitWeightDuration + grammyScore*hitWeightGrammys
+
+	return map[string]interface{}{
+		"song_id":         song.ID,
+		"title":           song.Title,
+		"hit_probability": roundTo(total, 3),
+		"features": map[string]interface{}{
+			"streams_millions":   feature(song.Streams, streamScore, hitWeightStreams),
+			"duration_seconds":   feature(song.Duration, durationScore, hitWeightDuration),
+			"grammy_nominations": feature(song.GrammyNoms, grammyScore, hitWeightGrammys),
+		},
+		"caveat": "Heuristic score for exploration only; not a trained prediction.",
+	}, nil
+}
+
+// eraTotals sums album and song metrics for the albums in era.
+func (p *PrestoClient) eraTotals(era string, stats map[string]albumStats) map[string]int64 {
+	totals := map[string]int64{
+		"album_count":            0,
+		"total_sales_millions":   0,
+		"total_streams_millions": 0,
+		"hits":                   0,
+		"grammy_nominations":     0,
+	}
+	for _, album := range p.albums {
+		if album.Era != era {
+			continue
+		}
+		st := stats[album.ID]
+		totals["album_count"]++
+		totals["total_sales_millions"] += album.Sales
+		totals["total_streams_millions"] += st.totalStreams
+		totals["hits"] += int64(st.hits)
+		totals["grammy_nominations"] += int64(st.grammyNoms)
+	}
+	return totals
+}
+
+// EraVsEra compares two eras side by side and names the winner of each
+// metric ("tie" when equal).
+func (p *PrestoClient) EraVsEra(ctx context.Context, eraA, eraB string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	nameA, ok := p.resolveEra(eraA)
+	if !ok {
+		return nil, p.unknownEraError("era_a", eraA)
+	}
+	nameB, ok := p.resolveEra(eraB)
+	if !ok {
+		return nil, p.unknownEraError("era_b", eraB)
+	}
+
+	stats := p.albumStatsByID()
+	a, b := p.eraTotals(nameA, stats), p.eraTotals(nameB, stats)
+
+	winners := make(map[string]string, len(a))
+	for metric := range a {
+		switch {
+		case a[metric] > b[metric]:
+			winners[metric] = nameA
+		case b[metric] > a[metric]:
+			winners[metric] = nameB
+		default:
+			winners[metric] = "tie"
+		}
+	}
+
+	return map[string]interface{}{
+		"era_a":   map[string]interface{}{"era": nameA, "metrics": a},
+		"era_b":   map[string]interface{}{"era": nameB, "metrics": b},
+		"winners": winners,
+	}, nil
+}
+
+// TopSongsPerEra returns the n most-streamed songs of each era, with eras
+// ordered by their first album's release. Eras with fewer than n songs list
+// all of them.
+func (p *PrestoClient) TopSongsPerEra(ctx context.Context, n int) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albums := p.albumIndex()
+	byEra := make(map[string][]Song)
+	for _, song := range p.songs {
+		if album, ok := albums[song.AlbumID]; ok {
+			byEra[album.Era] = append(byEra[album.Era], song)
+		}
+	}
+
+	var eras []string
+	seen := make(map[string]bool)
+	for _, album := range p.chronologicalAlbums() {
+		if !seen[album.Era] {
+			seen[album.Era] = true
+			eras = append(eras, album.Era)
+		}
+	}
+
+	groups := make([]map[string]interface{}, 0, len(eras))
+	for _, era := range eras {
+		songs := byEra[era]
+		sort.SliceStable(songs, func(i, j int) bool {
+			if songs[i].Streams != songs[j].Streams {
+				return songs[i].Streams > songs[j].Streams
+			}
+			return songs[i].ID < songs[j].ID
+		})
+		if len(songs) > n {
+			songs = songs[:n]
+		}
+
+		top := make([]map[string]interface{}, 0, len(songs))
+		for i, song := range songs {
+			top = append(top, map[string]interface{}{
+				"rank":             i + 1,
+				"song_id":          song.ID,
+				"title":            song.Title,
+				"album_title":      albums[song.AlbumID].Title,
+				"streams_millions": song.Streams,
+			})
+		}
+		groups = append(groups, map[string]interface{}{
+			"era":   era,
+			"songs": top,
+		})
+	}
+
+	return map[string]interface{}{
+		"n":         n,
+		"eras":      groups,
+		"row_count": len(groups),
+	}, nil
+}
+
+// Style groups used by StyleSplit. Albums whose genre isn't listed in
+// styleGroupByGenre fall into styleOther.
+const (
+	stylePop       = "pop_leaning"
+	styleFolkIndie = "folk_indie_leaning"
+	styleOther     = "other"
+)
+
+var styleGroupByGenre = map[string]string{
+	"Pop":         stylePop,
+	"Synth Pop":   stylePop,
+	"Electropop":  stylePop,
+	"Pop Rock":    stylePop,
+	"Indie Folk":  styleFolkIndie,
+	"Alternative": styleFolkIndie,
+}
+
+// StyleSplit partitions albums into pop-leaning, folk/indie-leaning and
+// other by genre, returning each group's sales and streams and its share of
+// the totals. overrides assigns genres to groups on top of
+// styleGroupByGenre, matching genres case-insensitively. The mapping used is
+// returned too so the classification is visible.
+func (p *PrestoClient) StyleSplit(ctx context.Context, overrides map[string]string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]string, len(styleGroupByGenre)+len(overrides))
+	for genre, group := range styleGroupByGenre {
+		mapping[genre] = group
+	}
+	for genre, group := range overrides {
+		if group != stylePop && group != styleFolkIndie && group != styleOther {
+			return nil, &ArgumentError{
+				Argument:     "genre_mapping",
+				Message:      fmt.Sprintf("unknown style group %q for genre %q", group, genre),
+				Value:        group,
+				ValidOptions: []string{stylePop, styleFolkIndie, styleOther},
+			}
+		}
+		for existing := range mapping {
+			if strings.EqualFold(existing, genre) {
+				delete(mapping, existing)
+			}
+		}
+		mapping[genre] = group
+	}
+	groupOf := func(genre string) string {
+		for g, group := range mapping {
+			if strings.EqualFold(g, genre) {
+				return group
+			}
+		}
+		return styleOther
+	}
+
+	type group struct {
+		albums  []string
+		sales   int64
+		streams int64
+	}
+
+	names := []string{stylePop, styleFolkIndie, styleOther}
+	groups := make(map[string]*group, len(names))
+	for _, name := range names {
+		groups[name] = &group{albums: make([]string, 0)}
+	}
+
+	stats := p.albumStatsByID()
+	var totalSales, totalStreams int64
+	for _, album := range p.chronologicalAlbums() {
+		g := groups[groupOf(album.Genre)]
+		g.albums = append(g.albums, album.Title)
+		g.sales += album.Sales
+		g.streams += stats[album.ID].totalStreams
+		totalSales += album.Sales
+		totalStreams += stats[album.ID].totalStreams
+	}
+
+	share := func(part, total int64) interface{} {
+		if total == 0 {
+			return nil
+		}
+		return roundTo(float64(part)/float64(total)*100, 1)
+	}
+
+	split := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		g := groups[name]
+		split[name] = map[string]interface{}{
+			"albums":            g.albums,
+			"sales_millions":    g.sales,
+			"streams_millions":  g.streams,
+			"sales_share_pct":   share(g.sales, totalSales),
+			"streams_share_pct": share(g.streams, totalStreams),
+		}
+	}
+
+	return map[string]interface{}{
+		"groups":         split,
+		"genre_mapping":  mapping,
+		"unmapped_group": styleOther,
+	}, nil
+}
+
+// SongLeaderboards returns the record holder for each song metric in one
+// pass over the songs. Ties go to the lowest song ID; songs that never
+// charted can't hold the best-charting record.
+func (p *PrestoClient) SongLeaderboards(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type board struct {
+		name   string
+		column string
+		value  func(Song) int64
+		better func(a, b int64) bool
+		ok     func(Song) bool
+		leader *Song
+	}
+
+	higher := func(a, b int64) bool { return a > b }
+	lower := func(a, b int64) bool { return a < b }
+	always := func(Song) bool { return true }
+
+	boards := []*board{
+		{name: "most_streamed", column: "streams_millions", value: func(s Song) int64 { return s.Streams }, better: higher, ok: always},
+		{name: "best_charting", column: "chart_peak", value: func(s Song) int64 { return int64(s.ChartPeak) }, better: lower,
+			ok: func(s Song) bool { return s.ChartPeak > 0 }},
+		{name: "most_grammy_nominated", column: "grammy_nominations", value: func(s Song) int64 { return int64(s.GrammyNoms) }, better: higher, ok: always},
+		{name: "longest", column: "duration_seconds", value: func(s Song) int64 { return int64(s.Duration) }, better: higher, ok: always},
+		{name: "shortest", column: "duration_seconds", value: func(s Song) int64 { return int64(s.Duration) }, better: lower, ok: always},
+	}
+
+	for i := range p.songs {
+		song := &p.songs[i]
+		for _, b := range boards {
+			if !b.ok(*song) {
+				continue
+			}
+			if b.leader == nil {
+				b.leader = song
+				continue
+			}
+			v, best := b.value(*song), b.value(*b.leader)
+			if b.better(v, best) || v == best && song.ID < b.leader.ID {
+				b.leader = song
+			}
+		}
+	}
+
+	albums := p.albumIndex()
+	leaderboards := make(map[string]interface{}, len(boards))
+	for _, b := range boards {
+		if b.leader == nil {
+			leaderboards[b.name] = nil
+			continue
+		}
+		leaderboards[b.name] = map[string]interface{}{
+			"song_id":     b.leader.ID,
+			"title":       b.leader.Title,
+			"album_title": albums[b.leader.AlbumID].Title,
+			"metric":      b.column,
+			"value":       b.value(*b.leader),
+		}
+	}
+
+	return map[string]interface{}{
+		"leaderboards": leaderboards,
+		"song_count":   len(p.songs),
+	}, nil
+}
+
+// careerPhase is a stretch of the career. Albums of one of its Eras belong
+// to it; albums of any other era fall back to release year, belonging to
+// the last phase whose StartYear they reach.
+type careerPhase struct {
+	Name           string   `json:"name"`
+	StartYear      int      `json:"start_year"`
+	Eras           []string `json:"eras"`
+	Characteristic string   `json:"characteristic"`
+}
+
+// careerPhases sets the phases used by CareerPhases, in chronological order.
+var careerPhases = []careerPhase{
+	{"Country", 0, []string{"Country"}, "Country songwriting roots"},
+	{"Transition", 2010, []string{"Country Pop"}, "Country-pop crossover"},
+	{"Pop", 2014, []string{"Pop", "Synth Pop"}, "Full pop reinvention and stadium-scale hits"},
+	{"Indie/Alternative", 2020, []string{"Indie Folk", "Alternative"}, "Indie folk and alternative songwriting"},
+}
+
+func careerPhaseNames() []string {
+	names := make([]string, 0, len(careerPhases))
+	for _, phase := range careerPhases {
+		names = append(names, phase.Name)
+	}
+	return names
+}
+
+// CareerPhases groups albums into the phases in careerPhases by era,
+// falling back to release year, with each phase's year range, eras, sales
+// and streams. startYears overrides the year boundary of the phases it
+// names; the boundaries must stay in chronological order.
+func (p *PrestoClient) CareerPhases(ctx context.Context, startYears map[string]int) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	phases := make([]careerPhase, len(careerPhases))
+	copy(phases, careerPhases)
+	for name, year := range startYears {
+		i := slices.IndexFunc(phases, func(phase careerPhase) bool { return strings.EqualFold(phase.Name, name) })
+		if i < 0 {
+			return nil, &ArgumentError{
+				Argument:     "phase_start_years",
+				Message:      fmt.Sprintf("unknown career phase %q", name),
+				Value:        name,
+				ValidOptions: careerPhaseNames(),
+			}
+		}
+		phases[i].StartYear = year
+	}
+	for i := 1; i < len(phases); i++ {
+		if phases[i].StartYear <= phases[i-1].StartYear {
+			return nil, &ArgumentError{
+				Argument: "phase_start_years",
+				Message: fmt.Sprintf("%s must start after %s (%d), got %d",
+					phases[i].Name, phases[i-1].Name, phases[i-1].StartYear, phases[i].StartYear),
+				Value: startYears,
+			}
+		}
+	}
+
+	type phaseTotals struct {
+		albums    []string
+		eras      []string
+		firstYear int
+		lastYear  int
+		sales     int64
+		streams   int64
+	}
+
+	totals := make([]phaseTotals, len(phases))
+	stats := p.albumStatsByID()
+	for _, album := range p.chronologicalAlbums() {
+		i := slices.IndexFunc(phases, func(phase careerPhase) bool { return slices.Contains(phase.Eras, album.Era) })
+		if i < 0 {
+			i = 0
+			for j, phase := range phases {
+				if album.ReleaseYear >= phase.StartYear {
+					i = j
+				}
+			}
+		}
+
+		t := &totals[i]
+		if len(t.albums) == 0 {
+			t.firstYear = album.ReleaseYear
+		}
+		t.lastYear = album.ReleaseYear
+		t.albums = append(t.albums, album.Title)
+		if len(t.eras) == 0 || t.eras[len(t.eras)-1] != album.Era {
+			t.eras = append(t.eras, album.Era)
+		}
+		t.sales += album.Sales
+		t.streams += stats[album.ID].totalStreams
+	}
+
+	rows := make([]map[string]interface{}, 0, len(phases))
+	for i, phase := range phases {
+		t := totals[i]
+		if len(t.albums) == 0 {
+			continue
+		}
+		rows = append(rows, map[string]interface{}{
+			"phase":            phase.Name,
+			"characteristic":   phase.Characteristic,
+			"years":            fmt.Sprintf("%d-%d", t.firstYear, t.lastYear),
+			"albums":           t.albums,
+			"eras":             t.eras,
+			"sales_millions":   t.sales,
+			"streams_millions": t.streams,
+		})
+	}
+
+	return map[string]interface{}{
+		"phases":     rows,
+		"boundaries": phases,
+		"row_count":  len(rows),
+	}, nil
+}
+
+// AlbumDurationOutliers flags songs whose duration is more than threshold
+// seconds away from their album's mean duration. Albums with a single song
+// have nothing to compare against and are skipped.
+func (p *PrestoClient) AlbumDurationOutliers(ctx context.Context, threshold float64) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	byAlbum := make(map[string][]Song)
+	for _, song := range p.songs {
+		byAlbum[song.AlbumID] = append(byAlbum[song.AlbumID], song)
+	}
+
+	rows := make([][]interface{}, 0)
+	for _, album := range p.chronologicalAlbums() {
+		songs := byAlbum[album.ID]
+		if len(songs) < 2 {
+			continue
+		}
+
+		mean, _ := meanStdDev(len(songs), func(i int) float64 { return float64(songs[i].Duration) })
+		for _, song := range songs {
+			deviation := float64(song.Duration) - mean
+			if math.Abs(deviation) <= threshold {
+				continue
+			}
+			rows = append(rows, []interface{}{
+				song.ID,
+				song.Title,
+				album.ID,
+				album.Title,
+				song.Duration,
+				roundTo(mean, 1),
+				roundTo(deviation, 1),
+			})
+		}
+	}
+
+	return &QueryResult{
+		Columns:  []string{"song_id", "title", "album_id", "album_title", "duration_seconds", "album_mean_seconds", "deviation_seconds"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// SummarySentence describes the catalog in one sentence built from the
+// current data, e.g. "Taylor Swift has released 11 albums spanning
+// 2006–2024, selling 62M copies, with The Eras Tour grossing $2.0B."
+func (p *PrestoClient) SummarySentence(ctx context.Context) (string, error) {
+	if err := p.enter(ctx); err != nil {
+		return "", err
+	}
+
+	if len(p.albums) == 0 {
+		return "Taylor Swift has no albums in the dataset yet.", nil
+	}
+
+	firstYear, lastYear := p.albums[0].ReleaseYear, p.albums[0].ReleaseYear
+	var sales int64
+	for _, album := range p.albums {
+		firstYear = min(firstYear, album.ReleaseYear)
+		lastYear = max(lastYear, album.ReleaseYear)
+		sales += album.Sales
+	}
+
+	albums := "albums"
+	if len(p.albums) == 1 {
+		albums = "album"
+	}
+	span := fmt.Sprintf("spanning %d–%d", firstYear, lastYear)
+	if firstYear == lastYear {
+		span = fmt.Sprintf("in %d", firstYear)
+	}
+	sentence := fmt.Sprintf("Taylor Swift has released %d %s %s, selling %dM copies",
+		len(p.albums), albums, span, sales)
+
+	var top *Tour
+	for i := range p.tours {
+		if top == nil || p.tours[i].Revenue > top.Revenue {
+			top = &p.tours[i]
+		}
+	}
+	if top != nil {
+		sentence += fmt.Sprintf(", with %s grossing %s", top.Name, formatMillionsUSD(top.Revenue))
+	}
+	return sentence + ".", nil
+}
+
+// formatMillionsUSD renders an amount in millions of dollars as "$345.7M"
+// or, from a billion up, "$2.0B".
+func formatMillionsUSD(millions float64) string {
+	if millions >= 1000 {
+		return fmt.Sprintf("$%.1fB", millions/1000)
+	}
+	return fmt.Sprintf("$%.1fM", millions)
+}
+
+// StreamsPerSecond ranks songs by streams (in millions) per second of
+// runtime. Songs with no recorded duration can't be ranked and are left out.
+func (p *PrestoClient) StreamsPerSecond(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type ranked struct {
+		song  Song
+		ratio float64
+	}
+
+	songs := make([]ranked, 0, len(p.songs))
+	for _, song := range p.songs {
+		if song.Duration <= 0 {
+			continue
+		}
+		songs = append(songs, ranked{song, float64(song.Streams) / float64(song.Duration)})
+	}
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i].ratio != songs[j].ratio {
+			return songs[i].ratio > songs[j].ratio
+		}
+		return songs[i].song.ID < songs[j].song.ID
+	})
+
+	albums := p.albumIndex()
+	rows := make([][]interface{}, 0, len(songs))
+	for _, r := range songs {
+		rows = append(rows, []interface{}{
+			r.song.ID,
+			r.song.Title,
+			albums[r.song.AlbumID].Title,
+			r.song.Streams,
+			r.song.Duration,
+			roundTo(r.ratio, 3),
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"song_id", "title", "album_title", "streams_millions", "duration_seconds", "streams_millions_per_second"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// ExportRecord is one row of the combined export: a record from one of the
+// three tables, tagged with the table it came from.
+type ExportRecord struct {
+	Table  string      `json:"table"`
+	Record interface{} `json:"record"`
+}
+
+// exportTotal is the number of records in the combined export dataset
+func (p *PrestoClient) exportTotal() int {
+	return len(p.albums) + len(p.songs) + len(p.tours)
+}
+
+// ExportChunk returns chunk index of the combined dataset (albums, then
+// songs, then tours) split into chunks of size records, along with the total
+// record count. An index at or past the last chunk yields an empty chunk.
+func (p *PrestoClient) ExportChunk(ctx context.Context, index, size int) ([]ExportRecord, int, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	total := p.exportTotal()
+	records := []ExportRecord{}
+	// Checked before multiplying so a huge index cannot overflow the offset
+	if index >= (total+size-1)/size {
+		return records, total, nil
+	}
+	for i := index * size; i < total && len(records) < size; i++ {
+		switch {
+		case i < len(p.albums):
+			records = append(records, ExportRecord{"albums", p.albums[i]})
+		case i < len(p.albums)+len(p.songs):
+			records = append(records, ExportRecord{"songs", p.songs[i-len(p.albums)]})
+		default:
+			records = append(records, ExportRecord{"tours", p.tours[i-len(p.albums)-len(p.songs)]})
+		}
+	}
+	return records, total, nil
+}
+
+// erasTourID identifies The Eras Tour, which dwarfs every other tour
+const erasTourID = "TOUR006"
+
+// ErasDominance measures how much of the all-time tour totals come from The
+// Eras Tour, with the totals recomputed without it. One row per metric.
+func (p *PrestoClient) ErasDominance(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	var eras *Tour
+	var allRevenue, allAttendance, allShows float64
+	for i, tour := range p.tours {
+		allRevenue += tour.Revenue
+		allAttendance += float64(tour.Attendance)
+		allShows += float64(tour.Shows)
+		if tour.ID == erasTourID {
+			eras = &p.tours[i]
+		}
+	}
+	if eras == nil {
+		return nil, fmt.Errorf("tour %s not found", erasTourID)
+	}
+
+	metric := func(name string, all, erasValue float64) []interface{} {
+		share := 0.0
+		if all > 0 {
+			share = erasValue / all * 100
+		}
+		return []interface{}{name, roundTo(all, 1), roundTo(erasValue, 1), roundTo(share, 1), roundTo(all-erasValue, 1)}
+	}
+
+	rows := [][]interface{}{
+		metric("revenue_millions", allRevenue, eras.Revenue),
+		metric("attendance", allAttendance, float64(eras.Attendance)),
+		metric("shows", allShows, float64(eras.Shows)),
+	}
+
+	return &QueryResult{
+		Columns:  []string{"metric", "all_time", "eras_tour", "eras_tour_pct", "excluding_eras_tour"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// median returns the middle value of values (the mean of the two middle
+// values for an even count), or 0 for none. values is not modified.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// UnderratedSongs finds songs with strong recognition — a chart peak at or
+// above maxChartPeak, or at least minGrammyNoms nominations — but streams
+// below the catalog median. The score is the song's recognition (chart
+// points plus nominations) scaled by how far its streams fall below the
+// median, so higher means more overlooked.
+func (p *PrestoClient) UnderratedSongs(ctx context.Context, maxChartPeak, minGrammyNoms int) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	streams := make([]float64, len(p.songs))
+	for i, song := range p.songs {
+		streams[i] = float64(song.Streams)
+	}
+	medianStreams := median(streams)
+
+	type gem struct {
+		song  Song
+		score float64
+	}
+
+	var gems []gem
+	for _, song := range p.songs {
+		charted := song.ChartPeak > 0 && song.ChartPeak <= maxChartPeak
+		recognized := song.GrammyNoms >= minGrammyNoms
+		if !charted && !recognized || float64(song.Streams) >= medianStreams || song.Streams <= 0 {
+			continue
+		}
+
+		quality := float64(song.GrammyNoms)
+		if charted {
+			quality += float64(maxChartPeak - song.ChartPeak + 1)
+		}
+		gems = append(gems, gem{song, quality * medianStreams / float64(song.Streams)})
+	}
+
+	sort.SliceStable(gems, func(i, j int) bool {
+		if gems[i].score != gems[j].score {
+			return gems[i].score > gems[j].score
+		}
+		return gems[i].song.ID < gems[j].song.ID
+	})
+
+	albums := p.albumIndex()
+	rows := make([][]interface{}, 0, len(gems))
+	for _, g := range gems {
+		rows = append(rows, []interface{}{
+			g.song.ID,
+			g.song.Title,
+			albums[g.song.AlbumID].Title,
+			g.song.ChartPeak,
+			g.song.GrammyNoms,
+			g.song.Streams,
+			roundTo(g.score, 2),
+		})
+	}
+
+	return map[string]interface{}{
+		"median_streams_millions": roundTo(medianStreams, 1),
+		"max_chart_peak":          maxChartPeak,
+		"min_grammy_nominations":  minGrammyNoms,
+		"row_count":               len(rows),
+		"songs": &QueryResult{
+			Columns:  []string{"song_id", "title", "album_title", "chart_peak", "grammy_nominations", "streams_millions", "underrated_score"},
+			Rows:     rows,
+			RowCount: len(rows),
+		},
+	}, nil
+}
+
+// TourIntensity ranks tours by how grueling they were. Tours only record a
+// single year, so each is assumed to run within that year: shows per year
+// is the tour's show count, and intensity is that count relative to the
+// busiest tour (1.0).
+func (p *PrestoClient) TourIntensity(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	tours := append([]Tour(nil), p.tours...)
+	sort.SliceStable(tours, func(i, j int) bool {
+		if tours[i].Shows != tours[j].Shows {
+			return tours[i].Shows > tours[j].Shows
+		}
+		return tours[i].ID < tours[j].ID
+	})
+
+	busiest := 0
+	if len(tours) > 0 {
+		busiest = tours[0].Shows
+	}
+
+	rows := make([][]interface{}, 0, len(tours))
+	for _, tour := range tours {
+		intensity, perShow := 0.0, 0.0
+		if busiest > 0 {
+			intensity = float64(tour.Shows) / float64(busiest)
+		}
+		if tour.Shows > 0 {
+			perShow = float64(tour.Attendance) / float64(tour.Shows)
+		}
+		rows = append(rows, []interface{}{
+			tour.ID,
+			tour.Name,
+			tour.Year,
+			tour.Shows,
+			roundTo(float64(tour.Shows)/12, 1),
+			roundTo(intensity, 3),
+			roundTo(perShow, 0),
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"tour_id", "name", "year", "shows", "shows_per_month", "intensity", "attendance_per_show"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// Popularity tier lower bounds, in millions of streams. A song belongs to
+// the first tier whose bound its streams exceed (Mega) or reach.
+const (
+	megaTierStreams     = 2000
+	bigTierStreams      = 1000
+	moderateTierStreams = 500
+)
+
+// popularityTiers lists the tiers from most to least streamed
+var popularityTiers = []string{"Mega", "Big", "Moderate", "Niche"}
+
+func popularityTier(streams int64) string {
+	switch {
+	case streams > megaTierStreams:
+		return "Mega"
+	case streams >= bigTierStreams:
+		return "Big"
+	case streams >= moderateTierStreams:
+		return "Moderate"
+	}
+	return "Niche"
+}
+
+// SongsByPopularityTier groups songs into stream-count tiers, most streamed
+// first within each tier. Every tier is present, even when empty.
+func (p *PrestoClient) SongsByPopularityTier(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	songs := append([]Song(nil), p.songs...)
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i].Streams != songs[j].Streams {
+			return songs[i].Streams > songs[j].Streams
+		}
+		return songs[i].ID < songs[j].ID
+	})
+
+	albums := p.albumIndex()
+	byTier := make(map[string][]map[string]interface{}, len(popularityTiers))
+	for _, song := range songs {
+		tier := popularityTier(song.Streams)
+		byTier[tier] = append(byTier[tier], map[string]interface{}{
+			"song_id":          song.ID,
+			"title":            song.Title,
+			"album_title":      albums[song.AlbumID].Title,
+			"streams_millions": song.Streams,
+		})
+	}
+
+	tiers := make([]map[string]interface{}, 0, len(popularityTiers))
+	counts := make(map[string]int, len(popularityTiers))
+	for _, tier := range popularityTiers {
+		members := byTier[tier]
+		if members == nil {
+			members = []map[string]interface{}{}
+		}
+		counts[tier] = len(members)
+		tiers = append(tiers, map[string]interface{}{
+			"tier":  tier,
+			"count": len(members),
+			"songs": members,
+		})
+	}
+
+	return map[string]interface{}{
+		"tiers":     tiers,
+		"counts":    counts,
+		"row_count": len(songs),
+	}, nil
+}
+
+// StreamPareto finds the fewest songs whose combined streams reach share
+// (0 < share <= 1) of the catalog total, taking the most streamed first.
+func (p *PrestoClient) StreamPareto(ctx context.Context, share float64) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	songs := append([]Song(nil), p.songs...)
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i].Streams != songs[j].Streams {
+			return songs[i].Streams > songs[j].Streams
+		}
+		return songs[i].ID < songs[j].ID
+	})
+
+	var total int64
+	for _, song := range songs {
+		total += song.Streams
+	}
+
+	albums := p.albumIndex()
+	rows := [][]interface{}{}
+	var cumulative int64
+	for _, song := range songs {
+		if total == 0 || float64(cumulative) >= share*float64(total) {
+			break
+		}
+		cumulative += song.Streams
+		rows = append(rows, []interface{}{
+			song.ID,
+			song.Title,
+			albums[song.AlbumID].Title,
+			song.Streams,
+			cumulative,
+			roundTo(float64(cumulative)/float64(total), 4),
+		})
+	}
+
+	catalogShare := 0.0
+	if len(songs) > 0 {
+		catalogShare = float64(len(rows)) / float64(len(songs))
+	}
+
+	return map[string]interface{}{
+		"threshold":              share,
+		"total_streams_millions": total,
+		"songs_needed":           len(rows),
+		"catalog_size":           len(songs),
+		"share_of_catalog":       roundTo(catalogShare, 4),
+		"row_count":              len(rows),
+		"songs": &QueryResult{
+			Columns:  []string{"song_id", "title", "album_title", "streams_millions", "cumulative_streams_millions", "cumulative_share"},
+			Rows:     rows,
+			RowCount: len(rows),
+		},
+	}, nil
+}
+
+// ValueDensity ranks albums by sales per song in the dataset. Albums with
+// no songs here would divide by zero and are left out.
+func (p *PrestoClient) ValueDensity(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type dense struct {
+		album   Album
+		songs   int
+		perSong float64
+	}
+
+	counts := p.songCounts()
+	albums := make([]dense, 0, len(p.albums))
+	for _, album := range p.albums {
+		n := counts[album.ID]
+		if n == 0 {
+			continue
+		}
+		albums = append(albums, dense{album, n, float64(album.Sales) / float64(n)})
+	}
+
+	sort.SliceStable(albums, func(i, j int) bool {
+		if albums[i].perSong != albums[j].perSong {
+			return albums[i].perSong > albums[j].perSong
+		}
+		return albums[i].album.ID < albums[j].album.ID
+	})
+
+	rows := make([][]interface{}, 0, len(albums))
+	for _, d := range albums {
+		rows = append(rows, []interface{}{d.album.ID, d.album.Title, d.album.Sales, d.songs, roundTo(d.perSong, 2)})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"album_id", "title", "sales_millions", "song_count", "sales_per_song_millions"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// MostConsistentEra ranks eras by how reliably their songs charted well.
+// The consistency score is 100 / (mean peak + peak stddev): a low, tight
+// spread of chart peaks scores high. Eras with fewer than two songs have no
+// meaningful spread and are left out.
+func (p *PrestoClient) MostConsistentEra(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albums := p.albumIndex()
+	peaks := make(map[string][]float64)
+	for _, song := range p.songs {
+		album, ok := albums[song.AlbumID]
+		if !ok {
+			continue
+		}
+		peaks[album.Era] = append(peaks[album.Era], float64(song.ChartPeak))
+	}
+
+	type eraSpread struct {
+		era         string
+		songs       int
+		mean, sd    float64
+		consistency float64
+	}
+
+	var eras []eraSpread
+	for era, values := range peaks {
+		if len(values) < 2 {
+			continue
+		}
+		mean, sd := meanStdDev(len(values), func(i int) float64 { return values[i] })
+		eras = append(eras, eraSpread{era, len(values), mean, sd, 100 / (mean + sd)})
+	}
+
+	sort.Slice(eras, func(i, j int) bool {
+		if eras[i].consistency != eras[j].consistency {
+			return eras[i].consistency > eras[j].consistency
+		}
+		return eras[i].era < eras[j].era
+	})
+
+	rows := make([][]interface{}, 0, len(eras))
+	for _, e := range eras {
+		rows = append(rows, []interface{}{e.era, e.songs, roundTo(e.mean, 2), roundTo(e.sd, 2), roundTo(e.consistency, 1)})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"era", "song_count", "mean_chart_peak", "chart_peak_stddev", "consistency_score"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// PlayQueue lays every song out as one listening session: albums in release
+// order, songs within an album by ID as a stand-in for track order. Each
+// entry carries its queue position and the elapsed time when it finishes.
+func (p *PrestoClient) PlayQueue(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albums := p.albumIndex()
+	songs := p.chronologicalSongs()
+
+	rows := make([][]interface{}, 0, len(songs))
+	elapsed := 0
+	for i, song := range songs {
+		elapsed += song.Duration
+		rows = append(rows, []interface{}{
+			i + 1,
+			song.ID,
+			song.Title,
+			albums[song.AlbumID].Title,
+			song.Duration,
+			elapsed,
+		})
+	}
+
+	return map[string]interface{}{
+		"total_duration_seconds": elapsed,
+		"total_duration":         (time.Duration(elapsed) * time.Second).String(),
+		"row_count":              len(rows),
+		"queue": &QueryResult{
+			Columns:  []string{"position", "song_id", "title", "album_title", "duration_seconds", "elapsed_seconds"},
+			Rows:     rows,
+			RowCount: len(rows),
+		},
+	}, nil
+}
+
+// GrammyByEra totals grammy nominations per era, with averages per album and
+// per song. Every era appears, including those without a single nomination.
+func (p *PrestoClient) GrammyByEra(ctx context.Context) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type eraNoms struct {
+		era                  string
+		albums, songs, total int
+	}
+
+	byEra := make(map[string]*eraNoms)
+	for _, album := range p.albums {
+		if byEra[album.Era] == nil {
+			byEra[album.Era] = &eraNoms{era: album.Era}
+		}
+		byEra[album.Era].albums++
+	}
+
+	albums := p.albumIndex()
+	for _, song := range p.songs {
+		album, ok := albums[song.AlbumID]
+		if !ok {
+			continue
+		}
+		byEra[album.Era].songs++
+		byEra[album.Era].total += song.GrammyNoms
+	}
+
+	eras := make([]*eraNoms, 0, len(byEra))
+	for _, e := range byEra {
+		eras = append(eras, e)
+	}
+	sort.Slice(eras, func(i, j int) bool {
+		if eras[i].total != eras[j].total {
+			return eras[i].total > eras[j].total
+		}
+		return eras[i].era < eras[j].era
+	})
+
+	perSong := func(e *eraNoms) float64 {
+		if e.songs == 0 {
+			return 0
+		}
+		return roundTo(float64(e.total)/float64(e.songs), 2)
+	}
+
+	rows := make([][]interface{}, 0, len(eras))
+	for _, e := range eras {
+		rows = append(rows, []interface{}{
+			e.era,
+			e.albums,
+			e.songs,
+			e.total,
+			roundTo(float64(e.total)/float64(e.albums), 2),
+			perSong(e),
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"era", "album_count", "song_count", "grammy_nominations", "noms_per_album", "noms_per_song"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// FreshestSongs ranks songs by a weighted blend of recency and momentum, as
+// of currentYear. Recency scales album release years from 0 (oldest) to 1
+// (newest); momentum is streams per year since release (age + 1, as in
+// StreamingMomentum) scaled so the fastest song is 1. The freshness score is
+// the weighted average of the two, so it also lies between 0 and 1.
+func (p *PrestoClient) FreshestSongs(ctx context.Context, currentYear int, recencyWeight, momentumWeight float64) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	type fresh struct {
+		song               Song
+		album              Album
+		recency, momentum  float64
+		freshness, perYear float64
+	}
+
+	albums := p.albumIndex()
+	songs := make([]fresh, 0, len(p.songs))
+	minYear, maxYear, maxPerYear := math.MaxInt, math.MinInt, 0.0
+	for _, song := range p.songs {
+		album, ok := albums[song.AlbumID]
+		if !ok {
+			continue
+		}
+		age := currentYear - album.ReleaseYear
+		if age < 0 {
+			age = 0
+		}
+		perYear := float64(song.Streams) / float64(age+1)
+
+		minYear = min(minYear, album.ReleaseYear)
+		maxYear = max(maxYear, album.ReleaseYear)
+		maxPerYear = math.Max(maxPerYear, perYear)
+		songs = append(songs, fresh{song: song, album: album, perYear: perYear})
+	}
+
+	for i := range songs {
+		f := &songs[i]
+		if maxYear > minYear {
+			f.recency = float64(f.album.ReleaseYear-minYear) / float64(maxYear-minYear)
+		}
+		if maxPerYear > 0 {
+			f.momentum = f.perYear / maxPerYear
+		}
+		f.freshness = (recencyWeight*f.recency + momentumWeight*f.momentum) / (recencyWeight + momentumWeight)
+	}
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i].freshness != songs[j].freshness {
+			return songs[i].freshness > songs[j].freshness
+		}
+		return songs[i].song.ID < songs[j].song.ID
+	})
+
+	rows := make([][]interface{}, 0, len(songs))
+	for _, f := range songs {
+		rows = append(rows, []interface{}{
+			f.song.ID,
+			f.song.Title,
+			f.album.Title,
+			f.album.ReleaseYear,
+			roundTo(f.perYear, 1),
+			roundTo(f.recency, 3),
+			roundTo(f.momentum, 3),
+			roundTo(f.freshness, 3),
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"song_id", "title", "album_title", "release_year", "streams_per_year", "recency_score", "momentum_score", "freshness_score"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// streamMaturityYears is how long after release a song is assumed to keep
+// growing; older songs are treated as having settled.
+const streamMaturityYears = 5
+
+// StreamProjection projects each song's streams horizon years past
+// currentYear. Songs whose album is younger than streamMaturityYears keep
+// adding their streams-per-year rate so far (age + 1, as in
+// StreamingMomentum); matured songs are projected at their current total.
+func (p *PrestoClient) StreamProjection(ctx context.Context, currentYear int, horizon float64) (*QueryResult, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	albums := p.albumIndex()
+	rows := make([][]interface{}, 0, len(p.songs))
+	for _, song := range p.chronologicalSongs() {
+		album, ok := albums[song.AlbumID]
+		if !ok {
+			continue
+		}
+		age := currentYear - album.ReleaseYear
+		if age < 0 {
+			age = 0
+		}
+
+		rate := float64(song.Streams) / float64(age+1)
+		status, projected := "matured", float64(song.Streams)
+		if age < streamMaturityYears {
+			status = "growing"
+			projected += rate * horizon
+		}
+
+		rows = append(rows, []interface{}{
+			song.ID,
+			song.Title,
+			album.Title,
+			album.ReleaseYear,
+			status,
+			song.Streams,
+			roundTo(rate, 1),
+			roundTo(projected, 1),
+		})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"song_id", "title", "album_title", "release_year", "status", "streams_millions", "streams_per_year", "projected_streams_millions"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}, nil
+}
+
+// DataGaps reports where the dataset is thin: albums with no songs, songs
+// with no grammy nominations, tours that don't map to an album, and years
+// between the first and latest release with no album out.
+func (p *PrestoClient) DataGaps(ctx context.Context) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	gap := func(records []map[string]interface{}) map[string]interface{} {
+		if records == nil {
+			records = []map[string]interface{}{}
+		}
+		return map[string]interface{}{"count": len(records), "records": records}
+	}
+
+	counts := p.songCounts()
+	var songless []map[string]interface{}
+	for _, album := range p.chronologicalAlbums() {
+		if counts[album.ID] == 0 {
+			songless = append(songless, map[string]interface{}{"album_id": album.ID, "title": album.Title})
+		}
+	}
+
+	var unnominated []map[string]interface{}
+	for _, song := range p.songs {
+		if song.GrammyNoms == 0 {
+			unnominated = append(unnominated, map[string]interface{}{"song_id": song.ID, "title": song.Title})
+		}
+	}
+
+	var unmapped []map[string]interface{}
+	for _, tour := range p.tours {
+		if _, ok := p.tourAlbum(tour); !ok {
+			unmapped = append(unmapped, map[string]interface{}{"tour_id": tour.ID, "name": tour.Name, "year": tour.Year})
+		}
+	}
+
+	released := make(map[int]bool)
+	first, latest := math.MaxInt, math.MinInt
+	for _, album := range p.albums {
+		released[album.ReleaseYear] = true
+		first = min(first, album.ReleaseYear)
+		latest = max(latest, album.ReleaseYear)
+	}
+	var quiet []map[string]interface{}
+	for year := first; year <= latest; year++ {
+		if !released[year] {
+			quiet = append(quiet, map[string]interface{}{"year": year})
+		}
+	}
+
+	return map[string]interface{}{
+		"albums_without_songs":      gap(songless),
+		"songs_without_grammy_noms": gap(unnominated),
+		"tours_without_album":       gap(unmapped),
+		"years_without_releases":    gap(quiet),
+	}, nil
+}
+
+// defaultTopSongs is how many songs top_songs returns without a usable limit
+const defaultTopSongs = 10
+
+// TopSongs returns the limit most-streamed songs, ties broken by song ID,
+// each with its album's title and era. A non-empty era restricts the
+// ranking to that era's songs; a limit past the song count returns them all.
+func (p *PrestoClient) TopSongs(ctx context.Context, limit int, era string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	if era != "" {
+		name, ok := p.resolveEra(era)
+		if !ok {
+			return nil, p.unknownEraError("era", era)
+		}
+		era = name
+	}
+
+	albums := p.albumIndex()
+	var songs []Song
+	for _, song := range p.songs {
+		if era == "" || albums[song.AlbumID].Era == era {
+			songs = append(songs, song)
+		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i].Streams != songs[j].Streams {
+			return songs[i].Streams > songs[j].Streams
+		}
+		return songs[i].ID < songs[j].ID
+	})
+	if len(songs) > limit {
+		songs = songs[:limit]
+	}
+
+	top := make([]map[string]interface{}, 0, len(songs))
+	for i, song := range songs {
+		album := albums[song.AlbumID]
+		top = append(top, map[string]interface{}{
+			"rank":             i + 1,
+			"song_id":          song.ID,
+			"title":            song.Title,
+			"album_title":      album.Title,
+			"era":              album.Era,
+			"streams_millions": song.Streams,
+		})
+	}
+
+	result := map[string]interface{}{
+		"limit":     limit,
+		"songs":     top,
+		"row_count": len(top),
+	}
+	if era != "" {
+		result["era"] = era
+	}
+	return result, nil
+}
+
+// resolveTour finds the tour a compare_tours argument names: an exact ID
+// (case-insensitive), else the one tour whose name contains the text. Text
+// matching several names is ambiguous rather than picking one.
+func (p *PrestoClient) resolveTour(argument, query string) (Tour, error) {
+	query = strings.TrimSpace(query)
+	names := make([]string, len(p.tours))
+	for i, tour := range p.tours {
+		names[i] = tour.Name
+		if strings.EqualFold(tour.ID, query) {
+			return tour, nil
+		}
+	}
+
+	var matches []Tour
+	for _, tour := range p.tours {
+		if query != "" && strings.Contains(strings.ToLower(tour.Name), strings.ToLower(query)) {
+			matches = append(matches, tour)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return Tour{}, &ArgumentError{
+			Argument:     argument,
+			Message:      fmt.Sprintf("no tour matches %q (valid tours: %s)", query, strings.Join(names, ", ")),
+			Value:        query,
+			ValidOptions: names,
+		}
+	}
+	ambiguous := make([]string, len(matches))
+	for i, tour := range matches {
+		ambiguous[i] = tour.Name
+	}
+	return Tour{}, &ArgumentError{
+		Argument:     argument,
+		Message:      fmt.Sprintf("%q matches several tours (%s); use a tour ID or more of the name", query, strings.Join(ambiguous, ", ")),
+		Value:        query,
+		ValidOptions: ambiguous,
+	}
+}
+
+// tourComparisonMetrics are the stats CompareTours reports for each tour,
+// including the per-show averages derived from the totals.
+func tourComparisonMetrics(tour Tour) map[string]float64 {
+	metrics := map[string]float64{
+		"shows":            float64(tour.Shows),
+		"attendance":       float64(tour.Attendance),
+		"revenue_millions": tour.Revenue,
+	}
+	if tour.Shows > 0 {
+		metrics["revenue_per_show_millions"] = roundTo(tour.Revenue/float64(tour.Shows), 3)
+		metrics["attendance_per_show"] = roundTo(float64(tour.Attendance)/float64(tour.Shows), 1)
+	}
+	return metrics
+}
+
+// CompareTours compares two tours side by side and names the winner of each
+// metric ("tie" when equal). Each tour may be given by ID or by part of its
+// name; both must resolve, and to different tours.
+func (p *PrestoClient) CompareTours(ctx context.Context, queryA, queryB string) (map[string]interface{}, error) {
+	if err := p.enter(ctx); err != nil {
+		return nil, err
+	}
+
+	tourA, err := p.resolveTour("tour_a", queryA)
+	if err != nil {
+		return nil, err
+	}
+	tourB, err := p.resolveTour("tour_b", queryB)
+	if err != nil {
+		return nil, err
+	}
+	if tourA.ID == tourB.ID {
+		return nil, &ArgumentError{
+			Argument: "tour_b",
+			Message:  fmt.Sprintf("tour_a and tour_b both resolve to %s (%s); pick two different tours", tourA.Name, tourA.ID),
+			Value:    queryB,
+		}
+	}
+
+	a, b := tourComparisonMetrics(tourA), tourComparisonMetrics(tourB)
+	winners := make(map[string]string, len(a))
+	for metric := range a {
+		switch {
+		case a[metric] > b[metric]:
+			winners[metric] = tourA.Name
+		case b[metric] > a[metric]:
+			winners[metric] = tourB.Name
+		default:
+			winners[metric] = "tie"
+		}
+	}
+
+	return map[string]interface{}{
+		"tour_a":  map[string]interface{}{"id": tourA.ID, "name": tourA.Name, "year": tourA.Year, "metrics": a},
+		"tour_b":  map[string]interface{}{"id": tourB.ID, "name": tourB.Name, "year": tourB.Year, "metrics": b},
+		"winners": winners,
+	}, nil
+}
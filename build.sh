@@ -9,7 +9,7 @@ rm -f mcp-server mcp-client
 
 # Build server
 echo "Building server..."
-go build -o mcp-server main.go handlers.go presto.go types.go
+go build -o mcp-server .
 
 # Build client from examples
 echo "Building client..."
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// defaultClientID attributes requests from clients that don't identify
+// themselves.
+const defaultClientID = "anonymous"
+
+// maxTrackedClients bounds the per-client breakdown; client ids are chosen
+// by clients, so anything past the limit is folded into overflowClientID.
+const (
+	maxTrackedClients = 256
+	overflowClientID  = "other"
+)
+
+// normalizeClientID trims id, returning "" for blank ids.
+func normalizeClientID(id string) string {
+	return strings.TrimSpace(id)
+}
+
+// ClientMetrics is the per-client slice of the server metrics.
+type ClientMetrics struct {
+	QueriesExecuted int64   `json:"queries_executed"`
+	Errors          int64   `json:"errors"`
+	AvgLatencyMS    float64 `json:"avg_latency_ms"`
+
+	totalLatencyMS int64
+}
+
+// clientMetrics accumulates tool-call counts and latency per client id.
+type clientMetrics struct {
+	mu      sync.Mutex
+	clients map[string]*ClientMetrics
+}
+
+func newClientMetrics() *clientMetrics {
+	return &clientMetrics{clients: make(map[string]*ClientMetrics)}
+}
+
+func (m *clientMetrics) record(clientID string, latencyMS int64, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.clients[clientID]
+	if !ok {
+		if len(m.clients) >= maxTrackedClients {
+			clientID = overflowClientID
+			stats = m.clients[clientID]
+		}
+		if stats == nil {
+			stats = &ClientMetrics{}
+			m.clients[clientID] = stats
+		}
+	}
+
+	stats.QueriesExecuted++
+	stats.totalLatencyMS += latencyMS
+	if failed {
+		stats.Errors++
+	}
+}
+
+func (m *clientMetrics) snapshot() map[string]ClientMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]ClientMetrics, len(m.clients))
+	for id, stats := range m.clients {
+		s := *stats
+		if s.QueriesExecuted > 0 {
+			s.AvgLatencyMS = float64(s.totalLatencyMS) / float64(s.QueriesExecuted)
+		}
+		out[id] = s
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt reads a positive integer from the environment, falling back to def
+func envInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		log.Printf("[WARN] Ignoring invalid %s=%q, using %d", name, raw, def)
+		return def
+	}
+	return n
+}
+
+// envBool reads a boolean flag from the environment, falling back to def
+func envBool(name string, def bool) bool {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("[WARN] Ignoring invalid %s=%q, using %v", name, raw, def)
+		return def
+	}
+	return b
+}
+
+// envDuration reads a positive duration such as "30s" from the environment,
+// falling back to def
+func envDuration(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("[WARN] Ignoring invalid %s=%q, using %v", name, raw, def)
+		return def
+	}
+	return d
+}
+
+// envList reads a comma-separated list from the environment, falling back to
+// def. Entries are trimmed and blank ones dropped.
+func envList(name string, def []string) []string {
+	raw, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
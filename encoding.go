@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Response versions a client can negotiate at initialize. Version 1 is the
+// original flat QueryResult; version 2 returns rows as column-keyed records;
+// version 3 wraps results in MCP content blocks.
+const (
+	responseVersionFlat     = "1"
+	responseVersionEnriched = "2"
+	responseVersionContent  = "3"
+)
+
+// resultEncoder shapes tool result content for one response version.
+type resultEncoder func(content interface{}) interface{}
+
+var resultEncoders = map[string]resultEncoder{
+	responseVersionFlat:     encodeFlat,
+	responseVersionEnriched: encodeEnriched,
+	responseVersionContent:  encodeContent,
+}
+
+// negotiateResponseVersion picks the version to use for a client request,
+// falling back to the flat form for empty or unsupported versions.
+func negotiateResponseVersion(requested string) string {
+	requested = strings.TrimPrefix(strings.TrimSpace(requested), "v")
+	if _, ok := resultEncoders[requested]; ok {
+		return requested
+	}
+	return responseVersionFlat
+}
+
+// encodeResult shapes content using the encoder registered for version.
+func encodeResult(version string, content interface{}) interface{} {
+	encoder, ok := resultEncoders[version]
+	if !ok {
+		encoder = encodeFlat
+	}
+	return encoder(content)
+}
+
+func encodeFlat(content interface{}) interface{} {
+	return content
+}
+
+func encodeEnriched(content interface{}) interface{} {
+	result, ok := content.(*QueryResult)
+	if !ok {
+		return content
+	}
+
+	records := make([]map[string]interface{}, 0, len(result.Rows))
+	for _, row := range result.formattedRows() {
+		record := make(map[string]interface{}, len(result.Columns))
+		for i, col := range result.Columns {
+			if i < len(row) {
+				record[col] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+
+	enriched := map[string]interface{}{
+		"response_version": responseVersionEnriched,
+		"columns":          result.Columns,
+		"records":          records,
+		"row_count":        result.RowCount,
+		"query_time_ms":    result.QueryTime.Milliseconds(),
+	}
+	if result.Empty {
+		enriched["empty"] = true
+		enriched["note"] = result.Note
+	}
+	return enriched
+}
+
+// contentBlock is one entry of an MCP tool result's content array
+type contentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// encodeContent is the standard MCP tool result: the content JSON-encoded
+// into a single text block.
+func encodeContent(content interface{}) interface{} {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return contentResult(fmt.Sprintf("failed to encode result: %v", err), true)
+	}
+	return contentResult(string(data), false)
+}
+
+// encodeToolError is the MCP form of a failed tool call: a result flagged
+// isError whose text block carries the error message. Protocol errors are
+// still sent as JSON-RPC errors.
+func encodeToolError(err *MCPError) interface{} {
+	return contentResult(err.Message, true)
+}
+
+func contentResult(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []contentBlock{{Type: "text", Text: text}},
+		"isError": isError,
+	}
+}
+
+// columnPrecision sets how many decimal places float values in a column are
+// serialized with. Only the JSON output is rounded; the data is untouched.
+var columnPrecision = map[string]int{
+	"revenue_millions": 1,
+}
+
+// parseColumnPrecision reads a spec like "revenue_millions=1,avg_streams=2".
+func parseColumnPrecision(spec string) (map[string]int, error) {
+	precision := make(map[string]int)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		col, places, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected column=places, got %q", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(places))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid precision for %s: %q", col, places)
+		}
+		precision[strings.TrimSpace(col)] = n
+	}
+	return precision, nil
+}
+
+// formattedRows returns the rows with float columns rendered at their
+// configured precision.
+func (r *QueryResult) formattedRows() [][]interface{} {
+	places := make(map[int]int)
+	for i, col := range r.Columns {
+		if n, ok := columnPrecision[col]; ok {
+			places[i] = n
+		}
+	}
+	if len(places) == 0 {
+		return r.Rows
+	}
+
+	rows := make([][]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		formatted := make([]interface{}, len(row))
+		copy(formatted, row)
+		for col, n := range places {
+			if col >= len(row) {
+				continue
+			}
+			if f, ok := row[col].(float64); ok {
+				formatted[col] = json.Number(strconv.FormatFloat(f, 'f', n, 64))
+			}
+		}
+		rows[i] = formatted
+	}
+	return rows
+}
+
+// MarshalJSON applies column precision so every response path formats
+// floats the same way.
+func (r QueryResult) MarshalJSON() ([]byte, error) {
+	type plain QueryResult
+	out := plain(r)
+	out.Rows = r.formattedRows()
+	return json.Marshal(out)
+}
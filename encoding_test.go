@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestColumnPrecisionRoundsFloats(t *testing.T) {
+	result := &QueryResult{
+		Columns:  []string{"name", "revenue_millions"},
+		Rows:     [][]interface{}{{"The Eras Tour", 2000.0}, {"The Red Tour", 150.26}},
+		RowCount: 2,
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	out := string(data)
+	for _, want := range []string{`"The Eras Tour",2000.0]`, `"The Red Tour",150.3]`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in %s", want, out)
+		}
+	}
+
+	// The underlying data must not be rounded.
+	if result.Rows[1][1] != 150.26 {
+		t.Errorf("row data was modified: %v", result.Rows[1][1])
+	}
+}
+
+func TestParseColumnPrecision(t *testing.T) {
+	precision, err := parseColumnPrecision("revenue_millions=2, avg_streams=0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if precision["revenue_millions"] != 2 || precision["avg_streams"] != 0 {
+		t.Errorf("unexpected precision map: %v", precision)
+	}
+
+	if _, err := parseColumnPrecision("revenue_millions=-1"); err == nil {
+		t.Error("expected error for negative precision")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// redactedValue replaces the value of a sensitive argument in logs
+const redactedValue = "[REDACTED]"
+
+// redactedArgKeys lists argument names (case-insensitive) whose values are
+// never written to the log. Set REDACT_ARGS to a comma-separated list to
+// replace the defaults; an empty value disables redaction.
+var redactedArgKeys = envList("REDACT_ARGS", []string{"password", "token", "secret", "api_key"})
+
+// redactArgs returns a copy of args with sensitive values masked. args
+// itself is left untouched since the handlers still need the real values.
+func redactArgs(args map[string]interface{}) map[string]interface{} {
+	if len(args) == 0 {
+		return args
+	}
+
+	masked := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		masked[name] = value
+		for _, key := range redactedArgKeys {
+			if strings.EqualFold(name, key) {
+				masked[name] = redactedValue
+				break
+			}
+		}
+	}
+	return masked
+}
+
+// logErrorResponse records a failed request. The summary line always goes
+// out; the arguments, redacted, follow at debug level.
+func logErrorResponse(connID string, req MCPRequest, invocation ToolInvocation, mcpErr *MCPError) {
+	tool := invocation.Name
+	if tool == "" {
+		tool = "-"
+	}
+
+	log.Printf("[ERROR] conn=%s request=%s method=%s tool=%s code=%d message=%q",
+		connID, req.ID, req.Method, tool, mcpErr.Code, mcpErr.Message)
+	if len(invocation.Arguments) > 0 {
+		log.Printf("[DEBUG] conn=%s request=%s arguments=%v", connID, req.ID, redactArgs(invocation.Arguments))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogErrorResponseRedactsSensitiveArguments(t *testing.T) {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+
+	req := MCPRequest{ID: "req-7", Method: "tools/call"}
+	invocation := ToolInvocation{
+		Name:      "query_songs",
+		Arguments: map[string]interface{}{"album_id": "ALB005", "API_Key": "hunter2"},
+	}
+	logErrorResponse("conn-1", req, invocation, newMCPError(codeInvalidParams, "bad album", nil))
+
+	out := buf.String()
+	for _, want := range []string{"conn=conn-1", "request=req-7", "tool=query_songs", "code=-32602", `message="bad album"`, "ALB005", redactedValue} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("log output leaked a redacted argument:\n%s", out)
+	}
+	if invocation.Arguments["API_Key"] != "hunter2" {
+		t.Error("redaction modified the caller's arguments")
+	}
+}
@@ -51,6 +51,25 @@ func main() {
 	}
 	log.Printf("Server info: %+v\n", serverInfo.Result)
 
+	// Initialize the session; tools are unavailable until this completes
+	initReq := MCPRequest{
+		JSONRPC: "2.0",
+		ID:      uuid.New().String(),
+		Method:  "initialize",
+	}
+
+	if err := conn.WriteJSON(initReq); err != nil {
+		log.Fatalf("Failed to send initialize: %v", err)
+	}
+
+	var initResp MCPResponse
+	if err := conn.ReadJSON(&initResp); err != nil {
+		log.Fatalf("Failed to read initialize response: %v", err)
+	}
+	if initResp.Error != nil {
+		log.Fatalf("Initialize failed: %s", initResp.Error.Message)
+	}
+
 	// List tools
 	log.Println("\n Listing available tools...")
 	listToolsReq := MCPRequest{
@@ -68,11 +87,15 @@ func main() {
 		log.Fatalf("Failed to read response: %v", err)
 	}
 
-	result := toolsResp.Result.(map[string]interface{})
-	tools := result["tools"].([]interface{})
+	if toolsResp.Error != nil {
+		log.Fatalf("Listing tools failed: %s", toolsResp.Error.Message)
+	}
+
+	result, _ := toolsResp.Result.(map[string]interface{})
+	tools, _ := result["tools"].([]interface{})
 	log.Printf("Available tools: %d\n", len(tools))
 	for _, t := range tools {
-		tool := t.(map[string]interface{})
+		tool, _ := t.(map[string]interface{})
 		log.Printf("  - %s: %s", tool["name"], tool["description"])
 	}
 
@@ -107,7 +130,7 @@ func main() {
 		log.Fatalf("Query failed: %v", queryResp.Error)
 	}
 
-	queryResult := queryResp.Result.(map[string]interface{})
+	queryResult, _ := queryResp.Result.(map[string]interface{})
 	log.Printf("Query completed in %v", duration)
 	log.Printf("Result: %+v\n", queryResult)
 
@@ -134,9 +157,17 @@ func main() {
 		log.Fatalf("Failed to send streaming query: %v", err)
 	}
 
+	// Batches arrive as progress notifications before the final response
 	var streamResp MCPResponse
-	if err := conn.ReadJSON(&streamResp); err != nil {
-		log.Fatalf("Failed to read response: %v", err)
+	for progress := 0; ; progress++ {
+		streamResp = MCPResponse{}
+		if err := conn.ReadJSON(&streamResp); err != nil {
+			log.Fatalf("Failed to read response: %v", err)
+		}
+		if streamResp.ID == streamReq.ID {
+			log.Printf("Received %d progress updates", progress)
+			break
+		}
 	}
 	duration = time.Since(start)
 
@@ -172,14 +203,22 @@ func main() {
 
 	log.Printf("Tour analysis completed in %v", duration)
 
-	tourResult := tourResp.Result.(map[string]interface{})
-	rows := tourResult["rows"].([]interface{})
+	if tourResp.Error != nil {
+		log.Fatalf("Tour analysis failed: %s", tourResp.Error.Message)
+	}
+
+	tourResult, _ := tourResp.Result.(map[string]interface{})
+	rows, _ := tourResult["rows"].([]interface{})
 
 	log.Println("\nTour Revenue Summary:")
 	for _, row := range rows {
-		r := row.([]interface{})
-		tourName := r[1].(string)
-		revenue := r[5].(float64)
+		r, ok := row.([]interface{})
+		if !ok || len(r) < 6 {
+			log.Printf("  skipping malformed row: %v", row)
+			continue
+		}
+		tourName, _ := r[1].(string)
+		revenue, _ := r[5].(float64)
 		log.Printf("  %s: $%.1fM", tourName, revenue)
 	}
 
@@ -2,225 +2,2553 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Server struct {
 	presto *PrestoClient
+	pool   *workerPool
+	tools  *toolRegistry
+
+	// Reject arguments a tool's inputSchema doesn't declare
+	strictArgs bool
+	// Largest batch ExecuteToolsConcurrently will accept
+	maxBatchSize int
+	// Most tools ExecuteToolsConcurrently runs at once
+	batchConcurrency int
+	// Results of calls made with an idempotency_key
+	idempotency *idempotencyCache
+	// Call and error counts per tool
+	stats *toolStats
+	// Metrics as they stood when the server was created, the default
+	// baseline for metrics_diff
+	baseline Metrics
+}
+
+func NewServer() *Server {
+	tools, err := buildToolRegistry(toolDefinitions())
+	if err != nil {
+		log.Fatalf("[ERROR] Invalid tool registry: %v", err)
+	}
+
+	presto := NewPrestoClient()
+	if problems := presto.validate(); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("[WARN] Data validation: %s", problem)
+		}
+		if envBool("STRICT_DATA", false) {
+			log.Fatalf("[ERROR] Data validation failed with %d problem(s)", len(problems))
+		}
+	}
+
+	s := &Server{
+		presto:           presto,
+		tools:            tools,
+		pool:             newWorkerPool(envInt("WORKER_POOL_SIZE", 16), envInt("WORKER_QUEUE_SIZE", 64)),
+		strictArgs:       envBool("STRICT_ARGS", false),
+		maxBatchSize:     envInt("MAX_BATCH_SIZE", 50),
+		batchConcurrency: envInt("BATCH_CONCURRENCY", 8),
+		stats:            newToolStats(),
+		idempotency:      newIdempotencyCache(envDuration("IDEMPOTENCY_TTL", 10*time.Minute), envInt("IDEMPOTENCY_CACHE_SIZE", 1000)),
+	}
+	s.baseline = snapshotMetrics(s)
+	return s
+}
+
+// recordOutcome counts a finished tools/call against its tool
+func (s *Server) recordOutcome(tool string, failed bool) {
+	if _, ok := s.tools.lookup(tool); !ok {
+		tool = unknownToolName
+	}
+	s.stats.record(tool, failed)
+}
+
+// ListTools returns available MCP tools
+func (s *Server) ListTools() []map[string]interface{} {
+	return s.tools.list()
+}
+
+// toolDefinitions declares every tool the server exposes along with its
+// handler. Names must be unique; NewServer refuses to start otherwise.
+func toolDefinitions() []toolSpec {
+	return []toolSpec{
+		{
+			name:        "list_tables",
+			description: "List all available tables in the Taylor Swift database",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleListTables,
+		},
+		{
+			name:        "query_albums",
+			description: "Query Taylor Swift albums with optional filters",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"era": map[string]string{
+						"type":        "string",
+						"description": "Filter by era (e.g., 'Pop', 'Country', 'Indie Folk')",
+					},
+					"count_only": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Return only row_count and columns, without rows",
+					},
+				},
+			},
+			handler: (*Server).handleQueryAlbums,
+		},
+		{
+			name:        "query_songs",
+			description: "Query Taylor Swift songs with streaming and chart data",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"album_id": map[string]string{
+						"type":        "string",
+						"description": "Filter by album ID",
+					},
+					"min_streams": map[string]interface{}{
+						"type":        "number",
+						"description": "Minimum streams in millions (a numeric string is also accepted)",
+					},
+					"min_chart_peak": map[string]interface{}{
+						"type":        "integer",
+						"description": "Best chart position to include, inclusive (e.g., 1)",
+					},
+					"max_chart_peak": map[string]interface{}{
+						"type":        "integer",
+						"description": "Worst chart position to include, inclusive (e.g., 5 for top-5 hits)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Return at most this many songs",
+					},
+					"offset": map[string]interface{}{
+						"type":        "integer",
+						"description": "Skip this many songs first, for paging (default 0)",
+					},
+					"count_only": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Return only row_count and columns, without rows",
+					},
+				},
+			},
+			handler: (*Server).handleQuerySongs,
+		},
+		{
+			name:        "analyze_tours",
+			description: "Analyze Taylor Swift tour data including revenue and attendance",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"count_only": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Return only row_count and columns, without rows",
+					},
+				},
+			},
+			handler: (*Server).handleAnalyzeTours,
+		},
+		{
+			name:        "streaming_query",
+			description: "Execute a large query with streaming results (for demo)",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"table": map[string]string{
+						"type":        "string",
+						"description": "Table to query (albums, songs, tours)",
+					},
+					"batch_size": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Rows per streamed batch (default %d, at most %d)", defaultStreamBatchSize, maxStreamBatchSize),
+						"minimum":     1,
+						"maximum":     maxStreamBatchSize,
+					},
+				},
+				"required": []string{"table"},
+			},
+			handler: (*Server).handleStreamingQuery,
+			streams: true,
+		},
+		{
+			name:        "stream_outliers",
+			description: "Find breakout songs whose streams sit well above the catalog mean, with z-scores",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"threshold": map[string]interface{}{
+						"type":        "number",
+						"description": "Standard deviations above the mean (default 2)",
+					},
+				},
+			},
+			handler: (*Server).handleStreamOutliers,
+		},
+		{
+			name:        "songs_in_eras",
+			description: "List songs from albums in any of the given eras, grouped by era",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"eras": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]string{"type": "string"},
+						"description": "Eras to include (e.g., ['Indie Folk', 'Pop'])",
+					},
+				},
+				"required": []string{"eras"},
+			},
+			handler: (*Server).handleSongsInEras,
+		},
+		{
+			name:        "tour_projection",
+			description: "Project revenue for a hypothetical future tour from the revenue-per-attendee trend",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"attendance": map[string]interface{}{
+						"type":        "number",
+						"description": "Expected total attendance (must be positive)",
+					},
+					"year": map[string]interface{}{
+						"type":        "integer",
+						"description": "Tour year to project for, no earlier than the first tour (default: year after the latest tour)",
+					},
+				},
+				"required": []string{"attendance"},
+			},
+			handler: (*Server).handleTourProjection,
+		},
+		{
+			name:        "songs_per_year",
+			description: "Count songs by their album's release year, in chronological order",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleSongsPerYear,
+		},
+		{
+			name:        "album_card",
+			description: "Get a summary card for one album: metadata, song and stream totals, hits, grammy nominations, and sales rank",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"album_id": map[string]string{
+						"type":        "string",
+						"description": "Album ID (e.g., 'ALB005')",
+					},
+				},
+				"required": []string{"album_id"},
+			},
+			handler: (*Server).handleAlbumCard,
+		},
+		{
+			name:        "albums_with_counts",
+			description: "List all albums with the number of songs each has in the dataset",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleAlbumsWithCounts,
+		},
+		{
+			name:        "chart_spread",
+			description: "Compare each album's best and worst charting song to gauge consistency",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleChartSpread,
+		},
+		{
+			name:        "streaming_momentum",
+			description: "Rank songs by streams per year since release to find the fastest-growing tracks. years_counted is the divisor: years since release, counting the release year, so it is at least 1",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleStreamingMomentum,
+		},
+		{
+			name:        "sort_songs",
+			description: "List all songs sorted by a numeric column, with album titles",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"column": map[string]interface{}{
+						"type":        "string",
+						"enum":        songNumericColumnNames(),
+						"description": "Numeric song column to sort by",
+					},
+					"order": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"asc", "desc"},
+						"description": "Sort direction (default 'desc')",
+					},
+				},
+				"required": []string{"column"},
+			},
+			handler: (*Server).handleSortSongs,
+		},
+		{
+			name:        "era_overview",
+			description: "Group albums by era with total sales and each era's best-selling album",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleEraOverview,
+		},
+		{
+			name:        "most_prolific_album",
+			description: "Find the album(s) with the most songs in the dataset, including ties",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleMostProlificAlbum,
+		},
+		{
+			name:        "duration_stream_correlation",
+			description: "Measure whether longer songs get more streams (Pearson correlation)",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleDurationStreamCorrelation,
+		},
+		{
+			name:        "tours_with_albums",
+			description: "List tours with the album each one promoted, including album sales and release year",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleToursWithAlbums,
+		},
+		{
+			name:        "stream_concentration",
+			description: "Measure how concentrated streams are among hit songs (Gini coefficient and top-20% share)",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleStreamConcentration,
+		},
+		{
+			name:        "rank_albums",
+			description: "Rank albums by sales, release year, song count, or total song streams",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"metric": map[string]interface{}{
+						"type":        "string",
+						"enum":        albumRankMetricNames(),
+						"description": "Metric to rank by",
+					},
+					"order": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"asc", "desc"},
+						"description": "Sort direction (default 'desc')",
+					},
+				},
+				"required": []string{"metric"},
+			},
+			handler: (*Server).handleRankAlbums,
+		},
+		{
+			name:        "era_profile",
+			description: "Get a complete profile of one era: albums, songs, sales, streams, hits, and tours",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"era": map[string]string{
+						"type":        "string",
+						"description": "Era name (e.g., 'Pop', 'Indie Folk')",
+					},
+				},
+				"required": []string{"era"},
+			},
+			handler: (*Server).handleEraProfile,
+		},
+		{
+			name:        "grammy_efficiency",
+			description: "Compare average grammy nominations of charting vs. non-charting songs",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"chart_threshold": map[string]interface{}{
+						"type":        "integer",
+						"description": "Worst chart peak that counts as charting (default 10)",
+					},
+				},
+			},
+			handler: (*Server).handleGrammyEfficiency,
+		},
+		{
+			name:        "album_neighbors",
+			description: "Get the albums released just before and after a given album",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"album_id": map[string]string{
+						"type":        "string",
+						"description": "Album ID (e.g., 'ALB005')",
+					},
+				},
+				"required": []string{"album_id"},
+			},
+			handler: (*Server).handleAlbumNeighbors,
+		},
+		{
+			name:        "chart_streaks",
+			description: "Find the longest run of consecutive #1 songs in release order",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleChartStreaks,
+		},
+		{
+			name:        "sales_weighted_era",
+			description: "Compute the sales-weighted average release year versus the simple average",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleSalesWeightedEra,
+		},
+		{
+			name:        "advanced_song_search",
+			description: "Search songs with any combination of filters (all must match), sorted by a chosen column",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"era": map[string]string{
+						"type":        "string",
+						"description": "Album era (e.g., 'Pop')",
+					},
+					"album_id": map[string]string{
+						"type":        "string",
+						"description": "Album ID (e.g., 'ALB005')",
+					},
+					"min_streams": map[string]interface{}{
+						"type":        "number",
+						"description": "Minimum streams in millions",
+					},
+					"max_chart_peak": map[string]interface{}{
+						"type":        "integer",
+						"description": "Worst chart position to include, inclusive",
+					},
+					"min_duration": map[string]interface{}{
+						"type":        "integer",
+						"description": "Minimum duration in seconds",
+					},
+					"title": map[string]string{
+						"type":        "string",
+						"description": "Case-insensitive title substring",
+					},
+					"sort_by": map[string]interface{}{
+						"type":        "string",
+						"enum":        append([]string{"title"}, songNumericColumnNames()...),
+						"description": "Column to sort by (default 'streams_millions')",
+					},
+					"order": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"asc", "desc"},
+						"description": "Sort direction (default 'desc')",
+					},
+					"count_only": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Return only row_count and columns, without rows",
+					},
+				},
+			},
+			handler: (*Server).handleAdvancedSongSearch,
+		},
+		{
+			name:        "tour_vs_sales",
+			description: "Compare each tour's revenue with its album's sales to see which eras earned more live than recorded",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleTourVsSales,
+		},
+		{
+			name:        "markdown_export",
+			description: "Render a table (optionally filtered like its query tool) as a GitHub-flavored markdown table",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"table": map[string]interface{}{
+						"type":        "string",
+						"enum":        markdownExportTableNames(),
+						"description": "Table to export",
+					},
+					"era": map[string]string{
+						"type":        "string",
+						"description": "albums: filter by era",
+					},
+					"album_id": map[string]string{
+						"type":        "string",
+						"description": "songs: filter by album ID",
+					},
+					"min_streams": map[string]interface{}{
+						"type":        "number",
+						"description": "songs: minimum streams in millions",
+					},
+					"min_chart_peak": map[string]interface{}{
+						"type":        "integer",
+						"description": "songs: best chart position to include",
+					},
+					"max_chart_peak": map[string]interface{}{
+						"type":        "integer",
+						"description": "songs: worst chart position to include",
+					},
+				},
+				"required": []string{"table"},
+			},
+			handler: (*Server).handleMarkdownExport,
+		},
+		{
+			name:        "streams_moving_average",
+			description: "Per-album stream totals in release order with an N-album moving average",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"window": map[string]interface{}{
+						"type":        "integer",
+						"description": "Number of albums to average over (default 3)",
+					},
+				},
+			},
+			handler: (*Server).handleStreamsMovingAverage,
+		},
+		{
+			name:        "data_version",
+			description: "Return a version id, checksum and load time for the loaded dataset, to detect stale caches",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleDataVersion,
+		},
+		{
+			name:        "per_album_averages",
+			description: "Career totals divided by album count: average sales, songs, streams and Grammy nominations per album",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handlePerAlbumAverages,
+		},
+		{
+			name:        "premium_tour",
+			description: "Find the tour with the highest revenue per attendee (in dollars), with the full ranking",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handlePremiumTour,
+		},
+		{
+			name:        "genre_catalog",
+			description: "Group the discography by genre, with each album's era and sales and each genre's total sales",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleGenreCatalog,
+		},
+		{
+			name:        "hit_probability",
+			description: "Score how hit-like a song is (0-1) from streams, duration and Grammy nominations, with per-feature contributions",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"song_id": map[string]string{
+						"type":        "string",
+						"description": "Song ID (e.g., 'SONG005')",
+					},
+				},
+				"required": []string{"song_id"},
+			},
+			handler: (*Server).handleHitProbability,
+		},
+		{
+			name:        "era_vs_era",
+			description: "Compare two eras head to head on albums, sales, streams, hits and Grammy nominations",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"era_a": map[string]string{
+						"type":        "string",
+						"description": "First era (e.g., 'Pop')",
+					},
+					"era_b": map[string]string{
+						"type":        "string",
+						"description": "Second era (e.g., 'Country')",
+					},
+				},
+				"required": []string{"era_a", "era_b"},
+			},
+			handler: (*Server).handleEraVsEra,
+		},
+		{
+			name:        "top_songs_per_era",
+			description: "The top N most-streamed songs within each era, eras in chronological order",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"n": map[string]interface{}{
+						"type":        "integer",
+						"description": "Songs per era (default 3)",
+					},
+				},
+			},
+			handler: (*Server).handleTopSongsPerEra,
+		},
+		{
+			name:        "style_split",
+			description: "Split sales and streams between pop-leaning and folk/indie-leaning albums by genre",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"genre_mapping": map[string]interface{}{
+						"type":        "object",
+						"description": fmt.Sprintf("Assign genres to %s, %s or %s on top of the default mapping, e.g. {\"Country Pop\": %q}", stylePop, styleFolkIndie, styleOther, stylePop),
+						"additionalProperties": map[string]interface{}{
+							"type": "string",
+							"enum": []string{stylePop, styleFolkIndie, styleOther},
+						},
+					},
+				},
+			},
+			handler: (*Server).handleStyleSplit,
+		},
+		{
+			name:        "song_leaderboards",
+			description: "Record-holding songs: most streamed, best charting, most Grammy-nominated, longest and shortest",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleSongLeaderboards,
+		},
+		{
+			name:        "career_phases",
+			description: "Segment the discography into career phases (Country, Transition, Pop, Indie/Alternative) by era, falling back to release year, with sales and streams",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"phase_start_years": map[string]interface{}{
+						"type":                 "object",
+						"description":          "Override the first year of named phases for albums whose era maps to no phase, e.g. {\"Pop\": 2015}",
+						"additionalProperties": map[string]string{"type": "integer"},
+					},
+				},
+			},
+			handler: (*Server).handleCareerPhases,
+		},
+		{
+			name:        "album_duration_outliers",
+			description: "Flag songs whose duration is far from their album's average, like interludes or epics",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"threshold_seconds": map[string]interface{}{
+						"type":        "number",
+						"description": "Seconds from the album mean to count as an outlier (default 20)",
+					},
+				},
+			},
+			handler: (*Server).handleAlbumDurationOutliers,
+		},
+		{
+			name:        "error_stats",
+			description: "Per-tool call counts, error counts and error rates since the server started",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleErrorStats,
+		},
+		{
+			name:        "summary_sentence",
+			description: "A one-sentence, shareable summary of the catalog computed from the current data",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleSummarySentence,
+		},
+		{
+			name:        "streams_per_second",
+			description: "Rank songs by streams per second of runtime, with album titles",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleStreamsPerSecond,
+		},
+		{
+			name:        "export_chunk",
+			description: "Export the combined albums, songs and tours dataset one chunk at a time",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"chunk_index": map[string]interface{}{
+						"type":        "integer",
+						"description": "Zero-based chunk to return",
+						"default":     0,
+					},
+					"chunk_size": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("Records per chunk (max %d)", maxExportChunkSize),
+						"default":     defaultExportChunkSize,
+					},
+				},
+			},
+			handler: (*Server).handleExportChunk,
+		},
+		{
+			name:        "schema",
+			description: "Return the column names and types of every table in one response",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleSchema,
+		},
+		{
+			name:        "eras_dominance",
+			description: "Show The Eras Tour's share of all-time tour revenue, attendance and shows, and the totals without it",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleErasDominance,
+		},
+		{
+			name:        "underrated_songs",
+			description: "Find hidden gems: songs that charted high or earned grammy nominations but stream below the catalog median",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"max_chart_peak": map[string]interface{}{
+						"type":        "integer",
+						"description": "Chart peak at or better than (≤) this counts as strong (default 5)",
+						"default":     underratedChartPeak,
+					},
+					"min_grammy_nominations": map[string]interface{}{
+						"type":        "integer",
+						"description": "Nominations at or above this count as strong (default 1)",
+						"default":     underratedGrammyNoms,
+					},
+				},
+			},
+			handler: (*Server).handleUnderratedSongs,
+		},
+		{
+			name:        "tour_intensity",
+			description: "Rank tours by how grueling they were. Tours only record a year, so each is assumed to run within that one year: shows per year is its show count, shows per month is that over 12, and intensity is relative to the busiest tour (1.0)",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleTourIntensity,
+		},
+		{
+			name:        "songs_by_popularity_tier",
+			description: popularityTierDescription(),
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleSongsByPopularityTier,
+		},
+		{
+			name:        "stream_pareto",
+			description: "Find the fewest top songs whose combined streams reach a share (default 50%) of all streams",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"threshold": map[string]interface{}{
+						"type":        "number",
+						"description": "Share of total streams to reach, between 0 and 1",
+						"default":     0.5,
+					},
+				},
+			},
+			handler: (*Server).handleStreamPareto,
+		},
+		{
+			name:        "value_density",
+			description: "Rank albums by sales per song in the dataset; albums without songs are excluded",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleValueDensity,
+		},
+		{
+			name:        "metrics_diff",
+			description: "Show how server metrics changed since a baseline: the server's startup snapshot, or one you captured from /metrics earlier",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"baseline": map[string]interface{}{
+						"type":        "object",
+						"description": "A previous /metrics (or metrics_diff current) snapshot; defaults to the startup snapshot",
+					},
+				},
+			},
+			handler: (*Server).handleMetricsDiff,
+		},
+		{
+			name:        "most_consistent_era",
+			description: "Rank eras by how consistently their songs charted: mean and spread of chart peaks, with a consistency score (higher is better)",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleMostConsistentEra,
+		},
+		{
+			name:        "play_queue",
+			description: "Every song as one ordered listening queue: albums in release order, songs by track order, with positions and elapsed time",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handlePlayQueue,
+		},
+		{
+			name:        "grammy_by_era",
+			description: "Total grammy nominations per era, with averages per album and per song",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleGrammyByEra,
+		},
+		{
+			name:        "freshest_songs",
+			description: "Rank songs by a freshness score blending recency of release with streaming momentum, with both components shown",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"recency_weight": map[string]interface{}{
+						"type":        "number",
+						"description": "Weight of release recency (default 0.5)",
+						"default":     0.5,
+					},
+					"momentum_weight": map[string]interface{}{
+						"type":        "number",
+						"description": "Weight of streams per year since release (default 0.5)",
+						"default":     0.5,
+					},
+				},
+			},
+			handler: (*Server).handleFreshestSongs,
+		},
+		{
+			name:        "stream_projection",
+			description: fmt.Sprintf("Project song streams a number of years ahead. Songs from albums under %d years old keep their streams-per-year rate; older songs are treated as matured", streamMaturityYears),
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"horizon_years": map[string]interface{}{
+						"type":        "number",
+						"description": "Years ahead to project (default 5)",
+						"default":     5,
+					},
+				},
+			},
+			handler: (*Server).handleStreamProjection,
+		},
+		{
+			name:        "data_gaps",
+			description: "Report where the dataset is sparse: albums without songs, songs without grammy nominations, tours without a matching album, and years with no releases",
+			inputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			handler: (*Server).handleDataGaps,
+		},
+		{
+			name:        "query_songs_with_album",
+			description: "List songs joined with their album's title, year and era",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"era": map[string]string{
+						"type":        "string",
+						"description": "Only songs from albums of this era (e.g., 'Pop')",
+					},
+					"album_id": map[string]string{
+						"type":        "string",
+						"description": "Only songs from this album (e.g., 'ALB005')",
+					},
+					"count_only": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Return only row_count and columns, without rows",
+					},
+				},
+			},
+			handler: (*Server).handleQuerySongsWithAlbum,
+		},
+		{
+			name:        "top_songs",
+			description: "The most-streamed songs overall or within one era, with each song's album era",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "How many songs to return (default 10; 0 or less also means 10)",
+					},
+					"era": map[string]string{
+						"type":        "string",
+						"description": "Only rank songs from this era (e.g., 'Pop')",
+					},
+				},
+			},
+			handler: (*Server).handleTopSongs,
+		},
+		{
+			name:        "compare_tours",
+			description: "Compare two tours side by side: shows, attendance, revenue and per-show averages",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tour_a": map[string]string{
+						"type":        "string",
+						"description": "Tour ID (e.g., 'TOUR001') or part of its name (e.g., 'Eras')",
+					},
+					"tour_b": map[string]string{
+						"type":        "string",
+						"description": "Tour ID or part of its name to compare against",
+					},
+				},
+				"required": []string{"tour_a", "tour_b"},
+			},
+			handler: (*Server).handleCompareTours,
+		},
+	}
+}
+
+// ExecuteTool handles tool invocation
+func (s *Server) ExecuteTool(ctx context.Context, invocation ToolInvocation) ToolResult {
+	log.Printf("[INFO] Tool invocation: %s", invocation.Name)
+	log.Printf("[DEBUG] Arguments: %v", redactArgs(invocation.Arguments))
+
+	tool, ok := s.tools.lookup(invocation.Name)
+	if !ok {
+		return errorResult(&ArgumentError{
+			Argument:     "name",
+			Message:      fmt.Sprintf("Unknown tool: %s", invocation.Name),
+			Value:        invocation.Name,
+			ValidOptions: s.tools.names(),
+		})
+	}
+
+	key, err := optionalStringArg(invocation.Arguments, idempotencyKeyArg)
+	if err != nil {
+		return errorResult(err)
+	}
+	if _, ok := invocation.Arguments[idempotencyKeyArg]; ok {
+		args := make(map[string]interface{}, len(invocation.Arguments)-1)
+		for name, value := range invocation.Arguments {
+			if name != idempotencyKeyArg {
+				args[name] = value
+			}
+		}
+		invocation.Arguments = args
+	}
+
+	if s.strictArgs {
+		if err := checkDeclaredArgs(tool, invocation); err != nil {
+			return errorResult(err)
+		}
+	}
+
+	run := func() ToolResult {
+		return markEmpty(tool.handler(s, ctx, invocation.Arguments))
+	}
+	if key == "" {
+		return run()
+	}
+
+	// Keys are scoped to the tool so the same key can't return another
+	// tool's result
+	result, cached, err := s.idempotency.do(ctx, invocation.Name+"\x00"+key, argumentsHash(invocation.Arguments), run)
+	if errors.Is(err, errIdempotencyKeyReused) {
+		return errorResult(&ArgumentError{
+			Argument: idempotencyKeyArg,
+			Message:  fmt.Sprintf("idempotency key %q was already used with different arguments for tool %s", key, invocation.Name),
+			Value:    key,
+		})
+	}
+	if err != nil {
+		return errorResult(err)
+	}
+	if cached {
+		log.Printf("[INFO] Returning cached result for %s (idempotency key %q)", invocation.Name, key)
+	}
+	return result
+}
+
+// checkDeclaredArgs rejects any argument not listed in the tool's
+// inputSchema properties.
+func checkDeclaredArgs(tool toolSpec, invocation ToolInvocation) error {
+	properties, _ := tool.inputSchema["properties"].(map[string]interface{})
+
+	declared := make([]string, 0, len(properties))
+	for name := range properties {
+		declared = append(declared, name)
+	}
+	sort.Strings(declared)
+
+	for name := range invocation.Arguments {
+		if _, ok := properties[name]; !ok {
+			return &ArgumentError{
+				Argument:     name,
+				Message:      fmt.Sprintf("unexpected argument %q for tool %s", name, invocation.Name),
+				ValidOptions: declared,
+			}
+		}
+	}
+	return nil
+}
+
+// emptyResultNote tells clients a zero-row result is a successful query that
+// matched nothing, not a failure.
+const emptyResultNote = "Query succeeded but no rows matched the given filters"
+
+// markEmpty flags successful tabular results that have no rows
+func markEmpty(result ToolResult) ToolResult {
+	if result.IsError {
+		return result
+	}
+
+	switch content := result.Content.(type) {
+	case *QueryResult:
+		if content.RowCount == 0 {
+			content.Empty = true
+			content.Note = emptyResultNote
+		}
+	case map[string]interface{}:
+		if count, ok := content["row_count"].(int); ok && count == 0 {
+			content["empty"] = true
+			content["note"] = emptyResultNote
+		}
+	}
+	return result
+}
+
+func (s *Server) handleListTables(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.Query(ctx, "SHOW TABLES")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Tool completed in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleQueryAlbums(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	countOnly, err := boolArg(args, "count_only", false)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	var filter AlbumFilter
+	if filter.Era, err = optionalStringArg(args, "era"); err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.QueryAlbums(ctx, filter)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	if countOnly {
+		result = result.withoutRows()
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleQuerySongs(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	countOnly, err := boolArg(args, "count_only", false)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	var filter SongFilter
+	if filter.AlbumID, err = optionalStringArg(args, "album_id"); err != nil {
+		return errorResult(err)
+	}
+	filter.AlbumID = strings.ToUpper(filter.AlbumID)
+
+	minStreams, err := numberOrStringArg(args, "min_streams", 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if minStreams < 0 {
+		return errorResult(&ArgumentError{Argument: "min_streams", Message: "min_streams must not be negative", Value: args["min_streams"]})
+	}
+	filter.MinStreams = int64(math.Ceil(minStreams))
+
+	if filter.MinChartPeak, err = positiveIntArg(args, "min_chart_peak", 0); err != nil {
+		return errorResult(err)
+	}
+	if filter.MaxChartPeak, err = positiveIntArg(args, "max_chart_peak", 0); err != nil {
+		return errorResult(err)
+	}
+	if filter.MinChartPeak > 0 && filter.MaxChartPeak > 0 && filter.MinChartPeak > filter.MaxChartPeak {
+		return errorResult(argError("min_chart_peak", "min_chart_peak must not exceed max_chart_peak"))
+	}
+
+	limit, err := positiveIntArg(args, "limit", -1)
+	if err != nil {
+		return errorResult(err)
+	}
+	offset, err := nonNegativeIntArg(args, "offset", 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.QuerySongs(ctx, filter)
+	if err != nil {
+		return errorResult(err)
+	}
+	applyLimit(result, limit, offset)
+
+	if countOnly {
+		result = result.withoutRows()
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleAnalyzeTours(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	countOnly, err := boolArg(args, "count_only", false)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	sql := "SELECT * FROM tours"
+	result, err := s.presto.Query(ctx, sql)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	if countOnly {
+		result = result.withoutRows()
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleStreamingQuery(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	table, err := stringArg(args, "table")
+	if err != nil {
+		return errorResult(err)
+	}
+	table = strings.ToLower(table)
+	// table is spliced into SQL, so only a bare table name may get through
+	if !slices.Contains(tableNames(), table) {
+		return errorResult(&ArgumentError{
+			Argument:     "table",
+			Message:      fmt.Sprintf("unknown table %q", table),
+			Value:        table,
+			ValidOptions: tableNames(),
+		})
+	}
+
+	batchSize, err := positiveIntArg(args, "batch_size", defaultStreamBatchSize)
+	if err != nil {
+		return errorResult(err)
+	}
+	if batchSize > maxStreamBatchSize {
+		return errorResult(&ArgumentError{
+			Argument: "batch_size",
+			Message:  fmt.Sprintf("batch_size must be at most %d", maxStreamBatchSize),
+			Value:    args["batch_size"],
+		})
+	}
+
+	sql := fmt.Sprintf("SELECT * FROM %s", table)
+
+	// Use streaming with batches
+	rowsChan, errChan := s.presto.StreamQuery(ctx, sql, batchSize)
+
+	batchCount := 0
+	totalRows := 0
+
+	for {
+		select {
+		case batch, ok := <-rowsChan:
+			if !ok {
+				log.Printf("[INFO] Streaming completed: %d batches, %d rows in %v",
+					batchCount, totalRows, time.Since(start))
+				return ToolResult{
+					Content: map[string]interface{}{
+						"batches":    batchCount,
+						"total_rows": totalRows,
+						"query_time": time.Since(start).Milliseconds(),
+					},
+					IsError: false,
+				}
+			}
+			batchCount++
+			totalRows += len(batch)
+			log.Printf("[DEBUG] Streaming batch %d (%d rows)", batchCount, len(batch))
+			reportProgress(ctx, map[string]interface{}{
+				"progress": batchCount,
+				"table":    table,
+				"rows":     batch,
+			})
+
+		case err := <-errChan:
+			if err != nil && ctx.Err() != nil {
+				return streamCancelled(ctx, batchCount)
+			}
+			if err != nil {
+				return errorResult(err)
+			}
+
+		case <-ctx.Done():
+			return streamCancelled(ctx, batchCount)
+		}
+	}
+}
+
+// Rows per streaming_query batch, unless the call asks for another size
+const (
+	defaultStreamBatchSize = 5
+	maxStreamBatchSize     = 1000
+)
+
+// streamCancelled ends a streaming query whose context is done, telling the
+// client how far it got before the error response arrives.
+func streamCancelled(ctx context.Context, batches int) ToolResult {
+	log.Printf("[WARN] Context cancelled: %v", ctx.Err())
+	reportProgress(ctx, map[string]interface{}{
+		"progress":  batches,
+		"cancelled": true,
+		"reason":    ctx.Err().Error(),
+	})
+	return errorResult(newMCPError(codeToolError, "Query cancelled", map[string]interface{}{"batches_sent": batches}))
+}
+
+func (s *Server) handleStreamOutliers(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	threshold, err := numberArg(args, "threshold", 2)
+	if err != nil {
+		return errorResult(err)
+	}
+	if threshold <= 0 {
+		return errorResult(argError("threshold", "threshold must be positive"))
+	}
+
+	result, err := s.presto.StreamOutliers(ctx, threshold)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Found %d stream outliers in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleSongsInEras(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	eras, err := stringListArg(args, "eras")
+	if err != nil {
+		return errorResult(err)
+	}
+	if len(eras) == 0 {
+		return errorResult(argError("eras", "eras must list at least one era"))
+	}
+
+	result, err := s.presto.SongsInEras(ctx, eras)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d songs across %d eras in %v", result["total_songs"], len(eras), time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleTourProjection(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	if _, ok := args["attendance"]; !ok {
+		return errorResult(argError("attendance", "attendance is required"))
+	}
+	attendance, err := numberArg(args, "attendance", 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if attendance <= 0 {
+		return errorResult(argError("attendance", "attendance must be positive"))
+	}
+
+	year, err := nonNegativeIntArg(args, "year", 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.TourProjection(ctx, int64(attendance), year)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Projected tour revenue in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleSongsPerYear(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.SongsPerYear(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleAlbumCard(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	albumID, err := stringArg(args, "album_id")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.AlbumCard(ctx, albumID)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Built album card for %s in %v", albumID, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleAlbumsWithCounts(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.AlbumsWithCounts(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleChartSpread(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.ChartSpread(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleStreamingMomentum(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.StreamingMomentum(ctx, start.Year())
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleSortSongs(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	column, err := stringArg(args, "column")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	descending, err := orderArg(args, "order", true)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.SortSongs(ctx, column, descending)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleEraOverview(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.EraOverview(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Summarized %d eras in %v", result["era_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleMostProlificAlbum(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.MostProlificAlbum(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleDurationStreamCorrelation(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.DurationStreamCorrelation(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed duration/stream correlation in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleToursWithAlbums(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.ToursWithAlbums(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleStreamConcentration(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.StreamConcentration(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed stream concentration in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleRankAlbums(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	metric, err := stringArg(args, "metric")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	descending, err := orderArg(args, "order", true)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.RankAlbums(ctx, metric, descending)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleEraProfile(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	era, err := stringArg(args, "era")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.EraProfile(ctx, era)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Built %s era profile in %v", result["era"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleGrammyEfficiency(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	threshold, err := positiveIntArg(args, "chart_threshold", hitChartPeak)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.GrammyEfficiency(ctx, threshold)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed grammy efficiency in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleAlbumNeighbors(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	albumID, err := stringArg(args, "album_id")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.AlbumNeighbors(ctx, albumID)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Found neighbors of %s in %v", albumID, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleChartStreaks(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.ChartStreaks(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Found %d-song chart streak in %v", result["streak_length"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleSalesWeightedEra(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.SalesWeightedEra(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed sales-weighted year in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleAdvancedSongSearch(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	countOnly, err := boolArg(args, "count_only", false)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	var filter SongFilter
+	if filter.Era, err = optionalStringArg(args, "era"); err != nil {
+		return errorResult(err)
+	}
+	if filter.AlbumID, err = optionalStringArg(args, "album_id"); err != nil {
+		return errorResult(err)
+	}
+	if filter.TitleContains, err = optionalStringArg(args, "title"); err != nil {
+		return errorResult(err)
+	}
+
+	minStreams, err := numberArg(args, "min_streams", 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if minStreams < 0 {
+		return errorResult(&ArgumentError{Argument: "min_streams", Message: "min_streams must not be negative", Value: minStreams})
+	}
+	filter.MinStreams = int64(math.Ceil(minStreams))
+
+	if filter.MaxChartPeak, err = positiveIntArg(args, "max_chart_peak", 0); err != nil {
+		return errorResult(err)
+	}
+	if filter.MinDuration, err = positiveIntArg(args, "min_duration", 0); err != nil {
+		return errorResult(err)
+	}
+
+	sortBy, err := optionalStringArg(args, "sort_by")
+	if err != nil {
+		return errorResult(err)
+	}
+	if sortBy == "" {
+		sortBy = "streams_millions"
+	}
+	descending, err := orderArg(args, "order", true)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.AdvancedSongSearch(ctx, filter, sortBy, descending)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	if countOnly {
+		result = result.withoutRows()
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleTourVsSales(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.TourVsSales(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+// markdownExportTables maps each exportable table to the query tool whose
+// filters and output it reuses.
+var markdownExportTables = map[string]string{
+	"albums": "query_albums",
+	"songs":  "query_songs",
+	"tours":  "analyze_tours",
+}
+
+func markdownExportTableNames() []string {
+	names := make([]string, 0, len(markdownExportTables))
+	for name := range markdownExportTables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) handleMarkdownExport(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	table, err := stringArg(args, "table")
+	if err != nil {
+		return errorResult(err)
+	}
+	table = strings.ToLower(table)
+
+	toolName, ok := markdownExportTables[table]
+	if !ok {
+		return errorResult(&ArgumentError{
+			Argument:     "table",
+			Message:      fmt.Sprintf("unknown table %q", table),
+			Value:        table,
+			ValidOptions: markdownExportTableNames(),
+		})
+	}
+
+	filters := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		if name != "table" {
+			filters[name] = value
+		}
+	}
+
+	tool, _ := s.tools.lookup(toolName)
+	queried := tool.handler(s, ctx, filters)
+	if queried.IsError {
+		return queried
+	}
+
+	result, ok := queried.Content.(*QueryResult)
+	if !ok {
+		return errorResult(fmt.Errorf("%s returned %T, not a table", toolName, queried.Content))
+	}
+
+	log.Printf("[INFO] Exported %d rows as markdown in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: map[string]interface{}{
+		"table":     table,
+		"row_count": result.RowCount,
+		"markdown":  renderMarkdownTable(result),
+	}, IsError: false}
+}
+
+func (s *Server) handleStreamsMovingAverage(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	window, err := positiveIntArg(args, "window", 3)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.StreamsMovingAverage(ctx, window)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleDataVersion(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.DataVersion(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed data version in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handlePerAlbumAverages(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.PerAlbumAverages(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed per-album averages in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handlePremiumTour(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.PremiumTour(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Ranked %v tours by revenue per attendee in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleGenreCatalog(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.GenreCatalog(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Grouped albums into %v genres in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleHitProbability(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	songID, err := stringArg(args, "song_id")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.HitProbability(ctx, songID)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Scored %s in %v", songID, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleEraVsEra(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	eraA, err := stringArg(args, "era_a")
+	if err != nil {
+		return errorResult(err)
+	}
+	eraB, err := stringArg(args, "era_b")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.EraVsEra(ctx, eraA, eraB)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Compared eras %s and %s in %v", eraA, eraB, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleTopSongsPerEra(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	n, err := positiveIntArg(args, "n", 3)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.TopSongsPerEra(ctx, n)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Ranked top songs across %v eras in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleStyleSplit(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	var overrides map[string]string
+	if raw, ok := args["genre_mapping"]; ok && raw != nil {
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return errorResult(&ArgumentError{Argument: "genre_mapping", Message: "genre_mapping must be an object of genres to style groups", Value: raw})
+		}
+		overrides = make(map[string]string, len(obj))
+		for genre, group := range obj {
+			name, ok := group.(string)
+			if !ok {
+				return errorResult(&ArgumentError{Argument: "genre_mapping", Message: fmt.Sprintf("style group for %s must be a string", genre), Value: group})
+			}
+			overrides[genre] = name
+		}
+	}
+
+	result, err := s.presto.StyleSplit(ctx, overrides)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed style split in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleSongLeaderboards(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.SongLeaderboards(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed song leaderboards in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleCareerPhases(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	var startYears map[string]int
+	if raw, ok := args["phase_start_years"]; ok && raw != nil {
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return errorResult(&ArgumentError{Argument: "phase_start_years", Message: "phase_start_years must be an object of phase names to years", Value: raw})
+		}
+		startYears = make(map[string]int, len(obj))
+		for name := range obj {
+			year, err := nonNegativeIntArg(obj, name, 0)
+			if err != nil {
+				return errorResult(&ArgumentError{Argument: "phase_start_years", Message: fmt.Sprintf("start year for %s must be a non-negative integer", name), Value: obj[name]})
+			}
+			startYears[name] = year
+		}
+	}
+
+	result, err := s.presto.CareerPhases(ctx, startYears)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Grouped albums into %v career phases in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleAlbumDurationOutliers(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	threshold, err := numberArg(args, "threshold_seconds", 20)
+	if err != nil {
+		return errorResult(err)
+	}
+	if threshold < 0 {
+		return errorResult(&ArgumentError{Argument: "threshold_seconds", Message: "threshold_seconds must not be negative", Value: threshold})
+	}
+
+	result, err := s.presto.AlbumDurationOutliers(ctx, threshold)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleErrorStats(ctx context.Context, _ map[string]interface{}) ToolResult {
+	if err := ctx.Err(); err != nil {
+		return errorResult(err)
+	}
+
+	result := errorStatsResult(s.stats.snapshot())
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleSummarySentence(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	sentence, err := s.presto.SummarySentence(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Built summary sentence in %v", time.Since(start))
+	return ToolResult{Content: sentence, IsError: false}
+}
+
+func (s *Server) handleStreamsPerSecond(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.StreamsPerSecond(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+const (
+	defaultExportChunkSize = 25
+	maxExportChunkSize     = 100
+)
+
+func (s *Server) handleExportChunk(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	index, err := nonNegativeIntArg(args, "chunk_index", 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	size, err := positiveIntArg(args, "chunk_size", defaultExportChunkSize)
+	if err != nil {
+		return errorResult(err)
+	}
+	if size > maxExportChunkSize {
+		return errorResult(&ArgumentError{
+			Argument: "chunk_size",
+			Message:  fmt.Sprintf("chunk_size must be at most %d", maxExportChunkSize),
+			Value:    size,
+		})
+	}
+
+	// One index past the last chunk is allowed and yields the empty final
+	// chunk; anything beyond that is a mistake.
+	totalChunks := (s.presto.exportTotal() + size - 1) / size
+	if index > totalChunks {
+		return errorResult(&ArgumentError{
+			Argument: "chunk_index",
+			Message:  fmt.Sprintf("chunk_index must be at most %d for chunk_size %d", totalChunks, size),
+			Value:    index,
+		})
+	}
+
+	records, total, err := s.presto.ExportChunk(ctx, index, size)
+	if err != nil {
+		return errorResult(err)
+	}
+	log.Printf("[INFO] Exported chunk %d/%d (%d records) in %v", index, totalChunks, len(records), time.Since(start))
+	return ToolResult{Content: map[string]interface{}{
+		"chunk_index":   index,
+		"chunk_size":    size,
+		"total_records": total,
+		"total_chunks":  totalChunks,
+		"has_more":      index+1 < totalChunks,
+		"row_count":     len(records),
+		"records":       records,
+	}, IsError: false}
+}
+
+func (s *Server) handleSchema(_ context.Context, _ map[string]interface{}) ToolResult {
+	schemas, err := tableSchemas()
+	if err != nil {
+		return errorResult(err)
+	}
+	return ToolResult{Content: map[string]interface{}{"tables": schemas}, IsError: false}
+}
+
+func (s *Server) handleErasDominance(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.ErasDominance(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+// Default recognition thresholds for underrated_songs
+const (
+	underratedChartPeak  = 5
+	underratedGrammyNoms = 1
+)
+
+func (s *Server) handleUnderratedSongs(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	maxChartPeak, err := positiveIntArg(args, "max_chart_peak", underratedChartPeak)
+	if err != nil {
+		return errorResult(err)
+	}
+	minGrammyNoms, err := positiveIntArg(args, "min_grammy_nominations", underratedGrammyNoms)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.UnderratedSongs(ctx, maxChartPeak, minGrammyNoms)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Found %v underrated songs in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleTourIntensity(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.TourIntensity(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
 }
 
-func NewServer() *Server {
-	return &Server{
-		presto: NewPrestoClient(),
+// popularityTierDescription spells out the tier boundaries so the tool
+// description follows the constants.
+func popularityTierDescription() string {
+	return fmt.Sprintf("Group songs into popularity tiers by streams: Mega (>%dM), Big (%d-%dM), Moderate (%d-%dM) and Niche (<%dM)",
+		megaTierStreams, bigTierStreams, megaTierStreams, moderateTierStreams, bigTierStreams, moderateTierStreams)
+}
+
+func (s *Server) handleSongsByPopularityTier(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.SongsByPopularityTier(ctx)
+	if err != nil {
+		return errorResult(err)
 	}
+
+	log.Printf("[INFO] Grouped songs into popularity tiers in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
 }
 
-// ListTools returns available MCP tools
-func (s *Server) ListTools() []map[string]interface{} {
-	return []map[string]interface{}{
-		{
-			"name":        "list_tables",
-			"description": "List all available tables in the Taylor Swift database",
-			"inputSchema": map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{},
-			},
-		},
-		{
-			"name":        "query_albums",
-			"description": "Query Taylor Swift albums with optional filters",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"era": map[string]string{
-						"type":        "string",
-						"description": "Filter by era (e.g., 'Pop', 'Country', 'Indie Folk')",
-					},
-				},
-			},
-		},
-		{
-			"name":        "query_songs",
-			"description": "Query Taylor Swift songs with streaming and chart data",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"album_id": map[string]string{
-						"type":        "string",
-						"description": "Filter by album ID",
-					},
-					"min_streams": map[string]interface{}{
-						"type":        "number",
-						"description": "Minimum streams in millions",
-					},
-				},
-			},
-		},
-		{
-			"name":        "analyze_tours",
-			"description": "Analyze Taylor Swift tour data including revenue and attendance",
-			"inputSchema": map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{},
-			},
-		},
-		{
-			"name":        "streaming_query",
-			"description": "Execute a large query with streaming results (for demo)",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"table": map[string]string{
-						"type":        "string",
-						"description": "Table to query (albums, songs, tours)",
-					},
-				},
-				"required": []string{"table"},
-			},
-		},
+func (s *Server) handleStreamPareto(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	threshold, err := numberArg(args, "threshold", 0.5)
+	if err != nil {
+		return errorResult(err)
+	}
+	if threshold <= 0 || threshold > 1 {
+		return errorResult(&ArgumentError{Argument: "threshold", Message: "threshold must be greater than 0 and at most 1", Value: threshold})
+	}
+
+	result, err := s.presto.StreamPareto(ctx, threshold)
+	if err != nil {
+		return errorResult(err)
 	}
+
+	log.Printf("[INFO] %v songs reach %.0f%% of streams (%v)", result["songs_needed"], threshold*100, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
 }
 
-// ExecuteTool handles tool invocation
-func (s *Server) ExecuteTool(ctx context.Context, invocation ToolInvocation) ToolResult {
-	log.Printf("[INFO] Tool invocation: %s", invocation.Name)
-	log.Printf("[DEBUG] Arguments: %v", invocation.Arguments)
-
-	switch invocation.Name {
-	case "list_tables":
-		return s.handleListTables(ctx)
-	case "query_albums":
-		return s.handleQueryAlbums(ctx, invocation.Arguments)
-	case "query_songs":
-		return s.handleQuerySongs(ctx, invocation.Arguments)
-	case "analyze_tours":
-		return s.handleAnalyzeTours(ctx)
-	case "streaming_query":
-		return s.handleStreamingQuery(ctx, invocation.Arguments)
-	default:
-		return ToolResult{
-			Content: fmt.Sprintf("Unknown tool: %s", invocation.Name),
-			IsError: true,
+func (s *Server) handleValueDensity(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.ValueDensity(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleMetricsDiff(_ context.Context, args map[string]interface{}) ToolResult {
+	baseline, source := s.baseline, "startup"
+	if raw, ok := args["baseline"]; ok && raw != nil {
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return errorResult(&ArgumentError{Argument: "baseline", Message: "baseline must be a metrics snapshot object", Value: raw})
+		}
+		encoded, _ := json.Marshal(obj)
+		baseline = Metrics{}
+		if err := json.Unmarshal(encoded, &baseline); err != nil {
+			return errorResult(&ArgumentError{Argument: "baseline", Message: fmt.Sprintf("baseline is not a metrics snapshot: %v", err)})
 		}
+		source = "client"
 	}
+
+	diff := diffMetrics(baseline, snapshotMetrics(s))
+	diff["baseline_source"] = source
+	return ToolResult{Content: diff, IsError: false}
 }
 
-func (s *Server) handleListTables(ctx context.Context) ToolResult {
+func (s *Server) handleMostConsistentEra(ctx context.Context, _ map[string]interface{}) ToolResult {
 	start := time.Now()
 
-	result, err := s.presto.Query(ctx, "SHOW TABLES")
+	result, err := s.presto.MostConsistentEra(ctx)
 	if err != nil {
-		return ToolResult{Content: err.Error(), IsError: true}
+		return errorResult(err)
 	}
 
-	log.Printf("[INFO] Tool completed in %v", time.Since(start))
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
 	return ToolResult{Content: result, IsError: false}
 }
 
-func (s *Server) handleQueryAlbums(ctx context.Context, args map[string]interface{}) ToolResult {
+func (s *Server) handlePlayQueue(ctx context.Context, _ map[string]interface{}) ToolResult {
 	start := time.Now()
 
-	sql := "SELECT * FROM albums"
-	result, err := s.presto.Query(ctx, sql)
+	result, err := s.presto.PlayQueue(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Built a %v-song play queue in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleGrammyByEra(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.GrammyByEra(ctx)
 	if err != nil {
-		return ToolResult{Content: err.Error(), IsError: true}
+		return errorResult(err)
 	}
 
 	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
 	return ToolResult{Content: result, IsError: false}
 }
 
-func (s *Server) handleQuerySongs(ctx context.Context, args map[string]interface{}) ToolResult {
+func (s *Server) handleFreshestSongs(ctx context.Context, args map[string]interface{}) ToolResult {
 	start := time.Now()
 
-	sql := "SELECT * FROM songs"
-	result, err := s.presto.Query(ctx, sql)
+	recency, err := numberArg(args, "recency_weight", 0.5)
+	if err != nil {
+		return errorResult(err)
+	}
+	if recency < 0 {
+		return errorResult(&ArgumentError{Argument: "recency_weight", Message: "recency_weight must not be negative", Value: recency})
+	}
+	momentum, err := numberArg(args, "momentum_weight", 0.5)
+	if err != nil {
+		return errorResult(err)
+	}
+	if momentum < 0 {
+		return errorResult(&ArgumentError{Argument: "momentum_weight", Message: "momentum_weight must not be negative", Value: momentum})
+	}
+	if recency+momentum == 0 {
+		return errorResult(argError("recency_weight", "recency_weight and momentum_weight can't both be zero"))
+	}
+
+	result, err := s.presto.FreshestSongs(ctx, start.Year(), recency, momentum)
 	if err != nil {
-		return ToolResult{Content: err.Error(), IsError: true}
+		return errorResult(err)
 	}
 
 	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
 	return ToolResult{Content: result, IsError: false}
 }
 
-func (s *Server) handleAnalyzeTours(ctx context.Context) ToolResult {
+func (s *Server) handleStreamProjection(ctx context.Context, args map[string]interface{}) ToolResult {
 	start := time.Now()
 
-	sql := "SELECT * FROM tours"
+	horizon, err := numberArg(args, "horizon_years", 5)
+	if err != nil {
+		return errorResult(err)
+	}
+	if horizon <= 0 {
+		return errorResult(&ArgumentError{Argument: "horizon_years", Message: "horizon_years must be a positive number of years", Value: horizon})
+	}
+
+	result, err := s.presto.StreamProjection(ctx, start.Year(), horizon)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleDataGaps(ctx context.Context, _ map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	result, err := s.presto.DataGaps(ctx)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Computed data gaps in %v", time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+func (s *Server) handleQuerySongsWithAlbum(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
+
+	countOnly, err := boolArg(args, "count_only", false)
+	if err != nil {
+		return errorResult(err)
+	}
+	era, err := optionalStringArg(args, "era")
+	if err != nil {
+		return errorResult(err)
+	}
+	albumID, err := optionalStringArg(args, "album_id")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	var where []string
+	if era != "" {
+		name, ok := s.presto.resolveEra(era)
+		if !ok {
+			return errorResult(s.presto.unknownEraError("era", era))
+		}
+		where = append(where, "albums.era = "+sqlQuote(name))
+	}
+	if albumID != "" {
+		where = append(where, "songs.album_id = "+sqlQuote(strings.ToUpper(albumID)))
+	}
+
+	sql := "SELECT * FROM songs JOIN albums ON songs.album_id = albums.id"
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
 	result, err := s.presto.Query(ctx, sql)
 	if err != nil {
-		return ToolResult{Content: err.Error(), IsError: true}
+		return errorResult(err)
+	}
+
+	if countOnly {
+		result = result.withoutRows()
 	}
 
 	log.Printf("[INFO] Returned %d rows in %v", result.RowCount, time.Since(start))
 	return ToolResult{Content: result, IsError: false}
 }
 
-func (s *Server) handleStreamingQuery(ctx context.Context, args map[string]interface{}) ToolResult {
+func (s *Server) handleTopSongs(ctx context.Context, args map[string]interface{}) ToolResult {
 	start := time.Now()
-	table := args["table"].(string)
 
-	sql := fmt.Sprintf("SELECT * FROM %s", table)
+	limit, err := intArg(args, "limit", defaultTopSongs)
+	if err != nil {
+		return errorResult(err)
+	}
+	if limit <= 0 {
+		limit = defaultTopSongs
+	}
 
-	// Use streaming with batches
-	rowsChan, errChan := s.presto.StreamQuery(ctx, sql, 5)
+	era, err := optionalStringArg(args, "era")
+	if err != nil {
+		return errorResult(err)
+	}
 
-	batchCount := 0
-	totalRows := 0
+	result, err := s.presto.TopSongs(ctx, limit, era)
+	if err != nil {
+		return errorResult(err)
+	}
 
-	for {
-		select {
-		case batch, ok := <-rowsChan:
-			if !ok {
-				log.Printf("[INFO] Streaming completed: %d batches, %d rows in %v",
-					batchCount, totalRows, time.Since(start))
-				return ToolResult{
-					Content: map[string]interface{}{
-						"batches":    batchCount,
-						"total_rows": totalRows,
-						"query_time": time.Since(start).Milliseconds(),
-					},
-					IsError: false,
-				}
-			}
-			batchCount++
-			totalRows += len(batch)
-			log.Printf("[DEBUG] Streaming batch %d (%d rows)", batchCount, len(batch))
+	log.Printf("[INFO] Ranked top %v songs in %v", result["row_count"], time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
 
-		case err := <-errChan:
-			if err != nil {
-				return ToolResult{Content: err.Error(), IsError: true}
-			}
+func (s *Server) handleCompareTours(ctx context.Context, args map[string]interface{}) ToolResult {
+	start := time.Now()
 
-		case <-ctx.Done():
-			log.Printf("[WARN] Context cancelled: %v", ctx.Err())
-			return ToolResult{Content: "Query cancelled", IsError: true}
+	tourA, err := stringArg(args, "tour_a")
+	if err != nil {
+		return errorResult(err)
+	}
+	tourB, err := stringArg(args, "tour_b")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result, err := s.presto.CompareTours(ctx, tourA, tourB)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	log.Printf("[INFO] Compared tours %q and %q in %v", tourA, tourB, time.Since(start))
+	return ToolResult{Content: result, IsError: false}
+}
+
+// errorResult wraps err as a failed ToolResult. Argument errors become
+// invalid-params errors carrying the argument details as data.
+func errorResult(err error) ToolResult {
+	var mcpErr *MCPError
+	var argErr *ArgumentError
+
+	switch {
+	case errors.As(err, &mcpErr):
+	case errors.As(err, &argErr):
+		mcpErr = newMCPError(codeInvalidParams, argErr.Message, argErr)
+	default:
+		mcpErr = newMCPError(codeToolError, err.Error(), nil)
+	}
+
+	return ToolResult{Content: mcpErr, IsError: true}
+}
+
+func argError(name, message string) *ArgumentError {
+	return &ArgumentError{Argument: name, Message: message}
+}
+
+// orderArg reads an optional "asc"/"desc" argument and reports whether it is
+// descending
+func orderArg(args map[string]interface{}, name string, defDescending bool) (bool, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return defDescending, nil
+	}
+
+	order, _ := v.(string)
+	switch strings.ToLower(order) {
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, &ArgumentError{
+			Argument:     name,
+			Message:      fmt.Sprintf("%s must be 'asc' or 'desc'", name),
+			Value:        v,
+			ValidOptions: []string{"asc", "desc"},
+		}
+	}
+}
+
+// stringArg reads a required non-empty string argument
+func stringArg(args map[string]interface{}, name string) (string, error) {
+	str, ok := args[name].(string)
+	if !ok || str == "" {
+		return "", argError(name, fmt.Sprintf("%s is required and must be a string", name))
+	}
+	return str, nil
+}
+
+// optionalStringArg reads an optional string argument, returning "" when absent
+func optionalStringArg(args map[string]interface{}, name string) (string, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+
+	str, ok := v.(string)
+	if !ok {
+		return "", &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be a string", name), Value: v}
+	}
+	return strings.TrimSpace(str), nil
+}
+
+// numberArg reads an optional numeric argument, falling back to def when absent
+func numberArg(args map[string]interface{}, name string, def float64) (float64, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	n, ok := v.(float64)
+	if !ok {
+		return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be a number", name), Value: v}
+	}
+	return n, nil
+}
+
+// numberOrStringArg is numberArg that also accepts a numeric string such as
+// "1000", for clients that send every argument as text
+func numberOrStringArg(args map[string]interface{}, name string, def float64) (float64, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(n), 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, nil
+		}
+	}
+	return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be a number", name), Value: v}
+}
+
+// intArg reads an optional argument that must be a whole number, of either
+// sign, no larger in magnitude than math.MaxInt32
+func intArg(args map[string]interface{}, name string, def int) (int, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	n, ok := v.(float64)
+	if !ok || n != math.Trunc(n) {
+		return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be an integer", name), Value: v}
+	}
+	if math.Abs(n) > math.MaxInt32 {
+		return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be between %d and %d", name, -math.MaxInt32, math.MaxInt32), Value: v}
+	}
+	return int(n), nil
+}
+
+// positiveIntArg reads an optional argument that must be a positive whole number
+func positiveIntArg(args map[string]interface{}, name string, def int) (int, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	n, ok := v.(float64)
+	if !ok || n != math.Trunc(n) || n < 1 {
+		return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be a positive integer", name), Value: v}
+	}
+	if n > math.MaxInt32 {
+		return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be at most %d", name, math.MaxInt32), Value: v}
+	}
+	return int(n), nil
+}
+
+// nonNegativeIntArg reads an optional argument that must be a whole number >= 0
+func nonNegativeIntArg(args map[string]interface{}, name string, def int) (int, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	n, ok := v.(float64)
+	if !ok || n != math.Trunc(n) || n < 0 {
+		return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be a non-negative integer", name), Value: v}
+	}
+	if n > math.MaxInt32 {
+		return 0, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be at most %d", name, math.MaxInt32), Value: v}
+	}
+	return int(n), nil
+}
+
+// boolArg reads an optional boolean argument
+func boolArg(args map[string]interface{}, name string, def bool) (bool, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, &ArgumentError{Argument: name, Message: fmt.Sprintf("%s must be a boolean", name), Value: v}
+	}
+	return b, nil
+}
+
+// stringListArg reads a required array-of-strings argument
+func stringListArg(args map[string]interface{}, name string) ([]string, error) {
+	raw, ok := args[name].([]interface{})
+	if !ok {
+		return nil, argError(name, fmt.Sprintf("%s must be an array of strings", name))
+	}
+
+	values := make([]string, 0, len(raw))
+	for _, item := range raw {
+		str, ok := item.(string)
+		if !ok {
+			return nil, argError(name, fmt.Sprintf("%s must be an array of strings", name))
 		}
+		values = append(values, str)
 	}
+	return values, nil
 }
 
-// ExecuteToolsConcurrently demonstrates parallel tool execution
-func (s *Server) ExecuteToolsConcurrently(ctx context.Context, tools []ToolInvocation) []ToolResult {
-	results := make(chan ToolResult, len(tools))
+// ExecuteToolsConcurrently demonstrates parallel tool execution. Batches
+// larger than maxBatchSize are rejected before anything runs; at most
+// batchConcurrency tools run at once while the rest wait their turn.
+// Results are returned in the same order as tools.
+func (s *Server) ExecuteToolsConcurrently(ctx context.Context, tools []ToolInvocation) ([]ToolResult, error) {
+	if len(tools) > s.maxBatchSize {
+		return nil, newMCPError(codeInvalidRequest,
+			fmt.Sprintf("batch of %d tool calls exceeds the limit of %d", len(tools), s.maxBatchSize),
+			map[string]int{"batch_size": len(tools), "max_batch_size": s.maxBatchSize})
+	}
+
+	limit := s.batchConcurrency
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+
+	output := make([]ToolResult, len(tools))
+	var wg sync.WaitGroup
+
+	for i, tool := range tools {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, t ToolInvocation) {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-	for _, tool := range tools {
-		go func(t ToolInvocation) {
 			// Add timeout per tool
 			toolCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 			defer cancel()
 
-			result := s.ExecuteTool(toolCtx, t)
-			results <- result
-		}(tool)
-	}
-
-	// Collect results
-	var output []ToolResult
-	for range tools {
-		output = append(output, <-results)
+			output[i] = s.ExecuteTool(toolCtx, t)
+		}(i, tool)
 	}
 
-	return output
+	wg.Wait()
+	return output, nil
 }
@@ -0,0 +1,742 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEmptyResultIsFlagged(t *testing.T) {
+	server := NewServer()
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "query_songs",
+		Arguments: map[string]interface{}{"min_chart_peak": float64(90)},
+	})
+	if result.IsError {
+		t.Fatalf("expected success, got error: %v", result.Content)
+	}
+
+	qr, ok := result.Content.(*QueryResult)
+	if !ok {
+		t.Fatalf("expected *QueryResult, got %T", result.Content)
+	}
+	if qr.RowCount != 0 || !qr.Empty {
+		t.Errorf("expected empty result flagged, got row_count=%d empty=%v", qr.RowCount, qr.Empty)
+	}
+	if qr.Note == "" {
+		t.Error("expected a note explaining the empty result")
+	}
+}
+
+func TestNonEmptyResultIsNotFlagged(t *testing.T) {
+	server := NewServer()
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "query_songs",
+		Arguments: map[string]interface{}{"max_chart_peak": float64(1)},
+	})
+	if result.IsError {
+		t.Fatalf("expected success, got error: %v", result.Content)
+	}
+
+	qr := result.Content.(*QueryResult)
+	if qr.RowCount == 0 || qr.Empty {
+		t.Errorf("expected rows without empty flag, got row_count=%d empty=%v", qr.RowCount, qr.Empty)
+	}
+}
+
+func TestEmptyFlagOnMapResults(t *testing.T) {
+	server := NewServer()
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "stream_outliers",
+		Arguments: map[string]interface{}{"threshold": float64(10)},
+	})
+	if result.IsError {
+		t.Fatalf("expected success, got error: %v", result.Content)
+	}
+
+	content := result.Content.(map[string]interface{})
+	if content["empty"] != true {
+		t.Errorf("expected empty flag on zero-row outliers, got %v", content["empty"])
+	}
+}
+
+func TestArgumentErrorsCarryStructuredData(t *testing.T) {
+	server := NewServer()
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "sort_songs",
+		Arguments: map[string]interface{}{"column": "popularity"},
+	})
+	if !result.IsError {
+		t.Fatal("expected error for unknown column")
+	}
+
+	mcpErr, ok := result.Content.(*MCPError)
+	if !ok {
+		t.Fatalf("expected *MCPError content, got %T", result.Content)
+	}
+	if mcpErr.Code != codeInvalidParams {
+		t.Errorf("expected code %d, got %d", codeInvalidParams, mcpErr.Code)
+	}
+
+	data, ok := mcpErr.Data.(*ArgumentError)
+	if !ok {
+		t.Fatalf("expected *ArgumentError data, got %T", mcpErr.Data)
+	}
+	if data.Argument != "column" || data.Value != "popularity" {
+		t.Errorf("unexpected argument details: %+v", data)
+	}
+	if len(data.ValidOptions) != len(songNumericColumns) {
+		t.Errorf("expected %d valid options, got %v", len(songNumericColumns), data.ValidOptions)
+	}
+}
+
+func TestStrictArgsRejectsUndeclaredArgument(t *testing.T) {
+	server := NewServer()
+	server.strictArgs = true
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "query_albums",
+		Arguments: map[string]interface{}{"eras": "Pop"},
+	})
+	if !result.IsError {
+		t.Fatal("expected strict mode to reject undeclared argument")
+	}
+
+	mcpErr := result.Content.(*MCPError)
+	if mcpErr.Code != codeInvalidParams {
+		t.Errorf("expected code %d, got %d", codeInvalidParams, mcpErr.Code)
+	}
+	if data := mcpErr.Data.(*ArgumentError); data.Argument != "eras" {
+		t.Errorf("expected error to name 'eras', got %q", data.Argument)
+	}
+}
+
+func TestStrictArgsAllowsDeclaredArguments(t *testing.T) {
+	server := NewServer()
+	server.strictArgs = true
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "query_songs",
+		Arguments: map[string]interface{}{"max_chart_peak": float64(3)},
+	})
+	if result.IsError {
+		t.Fatalf("expected declared argument to pass, got %v", result.Content)
+	}
+}
+
+func TestLenientArgsIgnoresUndeclaredArgument(t *testing.T) {
+	server := NewServer()
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "query_albums",
+		Arguments: map[string]interface{}{"eras": "Pop"},
+	})
+	if result.IsError {
+		t.Fatalf("expected lenient mode to ignore undeclared argument, got %v", result.Content)
+	}
+}
+
+func TestExecuteToolsConcurrentlyRejectsOversizedBatch(t *testing.T) {
+	server := NewServer()
+	server.maxBatchSize = 3
+
+	tools := make([]ToolInvocation, 4)
+	for i := range tools {
+		tools[i] = ToolInvocation{Name: "list_tables"}
+	}
+
+	results, err := server.ExecuteToolsConcurrently(context.Background(), tools)
+	if err == nil {
+		t.Fatal("expected oversized batch to be rejected")
+	}
+	if results != nil {
+		t.Errorf("expected no results for rejected batch, got %d", len(results))
+	}
+
+	results, err = server.ExecuteToolsConcurrently(context.Background(), tools[:3])
+	if err != nil {
+		t.Fatalf("expected batch at the limit to run, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("expected 3 results, got %d", len(results))
+	}
+}
+
+func TestExecuteToolsConcurrentlyBoundsParallelism(t *testing.T) {
+	server := NewServer()
+	server.batchConcurrency = 3
+
+	var active, peak atomic.Int32
+	err := server.tools.register(toolSpec{
+		name: "probe",
+		handler: func(s *Server, ctx context.Context, args map[string]interface{}) ToolResult {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return ToolResult{Content: args["index"]}
+		},
+	})
+	if err != nil {
+		t.Fatalf("register probe: %v", err)
+	}
+
+	tools := make([]ToolInvocation, 10)
+	for i := range tools {
+		tools[i] = ToolInvocation{Name: "probe", Arguments: map[string]interface{}{"index": i}}
+	}
+
+	results, err := server.ExecuteToolsConcurrently(context.Background(), tools)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := peak.Load(); got > 3 {
+		t.Errorf("expected at most 3 tools in flight, saw %d", got)
+	}
+	if got := peak.Load(); got < 2 {
+		t.Errorf("expected tools to run in parallel, saw %d in flight", got)
+	}
+	for i, result := range results {
+		if result.Content != i {
+			t.Errorf("result %d out of order: got %v", i, result.Content)
+		}
+	}
+}
+
+func TestCountOnlyMatchesFullQuery(t *testing.T) {
+	server := NewServer()
+
+	cases := []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"query_songs", map[string]interface{}{"max_chart_peak": float64(2)}},
+		{"query_albums", map[string]interface{}{}},
+		{"analyze_tours", map[string]interface{}{}},
+		{"advanced_song_search", map[string]interface{}{"era": "Pop"}},
+	}
+
+	for _, tc := range cases {
+		full := server.ExecuteTool(context.Background(), ToolInvocation{Name: tc.tool, Arguments: tc.args})
+		if full.IsError {
+			t.Fatalf("%s: unexpected error: %v", tc.tool, full.Content)
+		}
+
+		countArgs := map[string]interface{}{"count_only": true}
+		for k, v := range tc.args {
+			countArgs[k] = v
+		}
+		counted := server.ExecuteTool(context.Background(), ToolInvocation{Name: tc.tool, Arguments: countArgs})
+		if counted.IsError {
+			t.Fatalf("%s count_only: unexpected error: %v", tc.tool, counted.Content)
+		}
+
+		fullResult, countResult := full.Content.(*QueryResult), counted.Content.(*QueryResult)
+		if countResult.RowCount != len(fullResult.Rows) {
+			t.Errorf("%s: count_only row_count %d, full query returned %d rows", tc.tool, countResult.RowCount, len(fullResult.Rows))
+		}
+		if len(countResult.Rows) != 0 {
+			t.Errorf("%s: count_only returned %d rows, expected none", tc.tool, len(countResult.Rows))
+		}
+		if len(countResult.Columns) == 0 {
+			t.Errorf("%s: count_only dropped column metadata", tc.tool)
+		}
+	}
+}
+
+func TestIdempotencyKeyRunsToolOnce(t *testing.T) {
+	server := NewServer()
+
+	var runs atomic.Int32
+	err := server.tools.register(toolSpec{
+		name: "counter",
+		handler: func(s *Server, ctx context.Context, args map[string]interface{}) ToolResult {
+			if _, ok := args[idempotencyKeyArg]; ok {
+				t.Error("handler should not see the idempotency key")
+			}
+			return ToolResult{Content: runs.Add(1)}
+		},
+	})
+	if err != nil {
+		t.Fatalf("register counter: %v", err)
+	}
+
+	call := func(key string) ToolResult {
+		return server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "counter",
+			Arguments: map[string]interface{}{idempotencyKeyArg: key},
+		})
+	}
+
+	first, second := call("order-42"), call("order-42")
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("expected a single execution for a repeated key, got %d", got)
+	}
+	if first.Content != second.Content {
+		t.Errorf("expected the cached result on repeat, got %v then %v", first.Content, second.Content)
+	}
+
+	call("order-43")
+	if got := runs.Load(); got != 2 {
+		t.Errorf("expected a new key to execute, got %d executions", got)
+	}
+}
+
+func TestIdempotencyEntriesExpire(t *testing.T) {
+	cache := newIdempotencyCache(10*time.Millisecond, 10)
+
+	runs := 0
+	run := func() ToolResult {
+		runs++
+		return ToolResult{Content: runs}
+	}
+
+	ctx := context.Background()
+	cache.do(ctx, "k", "args", run)
+	if _, cached, _ := cache.do(ctx, "k", "args", run); !cached {
+		t.Error("expected a cached result within the TTL")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, cached, _ := cache.do(ctx, "k", "args", run); cached {
+		t.Error("expected the entry to expire after the TTL")
+	}
+	if runs != 2 {
+		t.Errorf("expected 2 executions, got %d", runs)
+	}
+}
+
+func TestIdempotencyKeyRejectsDifferentArguments(t *testing.T) {
+	server := NewServer()
+
+	call := func(album string) ToolResult {
+		return server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "album_card",
+			Arguments: map[string]interface{}{"album_id": album, idempotencyKeyArg: "card-1"},
+		})
+	}
+
+	if result := call("ALB001"); result.IsError {
+		t.Fatalf("first call failed: %+v", result.Content)
+	}
+	if result := call("ALB001"); result.IsError {
+		t.Errorf("repeat with the same arguments failed: %+v", result.Content)
+	}
+
+	result := call("ALB002")
+	mcpErr, ok := result.Content.(*MCPError)
+	if !result.IsError || !ok || mcpErr.Code != codeInvalidParams {
+		t.Fatalf("expected %d for a reused key, got %+v", codeInvalidParams, result.Content)
+	}
+	if argErr, ok := mcpErr.Data.(*ArgumentError); !ok || argErr.Argument != idempotencyKeyArg {
+		t.Errorf("expected the error to name %s, got %+v", idempotencyKeyArg, mcpErr.Data)
+	}
+}
+
+func TestIdempotencyPanicReleasesWaiters(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute, 10)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		cache.do(ctx, "k", "args", func() ToolResult {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waited := make(chan ToolResult, 1)
+	go func() {
+		result, _, err := cache.do(ctx, "k", "args", func() ToolResult {
+			return ToolResult{Content: "rerun"}
+		})
+		if err != nil {
+			t.Errorf("waiter failed: %v", err)
+		}
+		waited <- result
+	}()
+
+	close(release)
+	if p := <-panicked; p == nil {
+		t.Fatal("the panic should reach the caller")
+	}
+	select {
+	case result := <-waited:
+		if result.Content != "rerun" {
+			t.Errorf("expected the waiter to rerun, got %v", result.Content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter blocked after the first call panicked")
+	}
+
+	result, cached, err := cache.do(ctx, "k", "args", func() ToolResult { return ToolResult{Content: "again"} })
+	if err != nil || !cached || result.Content != "rerun" {
+		t.Errorf("expected the rerun's result to be cached, got %v (cached %v, err %v)", result.Content, cached, err)
+	}
+}
+
+func TestIdempotencyWaiterHonoursContext(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute, 10)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	go cache.do(context.Background(), "k", "args", func() ToolResult {
+		close(started)
+		<-release
+		return ToolResult{}
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := cache.do(ctx, "k", "args", func() ToolResult { return ToolResult{} }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the waiter to give up with its context, got %v", err)
+	}
+}
+
+func TestMetricsDiffAgainstSubmittedBaseline(t *testing.T) {
+	s := NewServer()
+	baseline := snapshotMetrics(s)
+
+	queriesExecuted.Add(4)
+	totalLatency.Add(40)
+	t.Cleanup(func() {
+		queriesExecuted.Add(-4)
+		totalLatency.Add(-40)
+	})
+
+	encoded, _ := json.Marshal(baseline)
+	var arg map[string]interface{}
+	json.Unmarshal(encoded, &arg)
+
+	result := s.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "metrics_diff",
+		Arguments: map[string]interface{}{"baseline": arg},
+	})
+	if result.IsError {
+		t.Fatalf("metrics_diff failed: %v", result.Content)
+	}
+
+	diff := result.Content.(map[string]interface{})
+	if diff["baseline_source"] != "client" {
+		t.Errorf("expected the submitted baseline to be used, got %v", diff["baseline_source"])
+	}
+	if got := diff["queries_executed_delta"]; got != int64(4) {
+		t.Errorf("expected 4 queries in the window, got %v", got)
+	}
+	if got := diff["window_avg_latency_ms"]; got != 10.0 {
+		t.Errorf("expected 10ms average over the window, got %v", got)
+	}
+}
+
+func TestQueryAlbumsFiltersByEra(t *testing.T) {
+	server := NewServer()
+
+	for _, tc := range []struct {
+		era  interface{}
+		want int
+	}{
+		{"pop", 3},
+		{"Indie Folk", 2},
+		{"", 11},
+		{nil, 11},
+		{"Disco", 0},
+	} {
+		args := map[string]interface{}{}
+		if tc.era != nil {
+			args["era"] = tc.era
+		}
+		result := server.ExecuteTool(context.Background(), ToolInvocation{Name: "query_albums", Arguments: args})
+		if result.IsError {
+			t.Fatalf("era %v: unexpected error %v", tc.era, result.Content)
+		}
+		qr := result.Content.(*QueryResult)
+		if qr.RowCount != tc.want {
+			t.Errorf("era %v: expected %d albums, got %d", tc.era, tc.want, qr.RowCount)
+		}
+		for _, row := range qr.Rows {
+			if era, _ := tc.era.(string); era != "" && !strings.EqualFold(row[3].(string), era) {
+				t.Errorf("era %v: got album from era %v", tc.era, row[3])
+			}
+		}
+	}
+}
+
+func TestQuerySongsFiltersByAlbumAndStreams(t *testing.T) {
+	server := NewServer()
+
+	for _, minStreams := range []interface{}{1000.0, "1000"} {
+		result := server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "query_songs",
+			Arguments: map[string]interface{}{"album_id": "ALB005", "min_streams": minStreams},
+		})
+		if result.IsError {
+			t.Fatalf("min_streams %#v: unexpected error %v", minStreams, result.Content)
+		}
+
+		qr := result.Content.(*QueryResult)
+		if qr.RowCount != 4 {
+			t.Errorf("min_streams %#v: expected 4 songs, got %d", minStreams, qr.RowCount)
+		}
+		for _, row := range qr.Rows {
+			if row[1] != "ALB005" || row[4].(int64) < 1000 {
+				t.Errorf("min_streams %#v: unexpected row %v", minStreams, row)
+			}
+		}
+	}
+}
+
+func TestQuerySongsRejectsNonNumericMinStreams(t *testing.T) {
+	result := NewServer().ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "query_songs",
+		Arguments: map[string]interface{}{"min_streams": "lots"},
+	})
+
+	mcpErr, ok := result.Content.(*MCPError)
+	if !result.IsError || !ok || mcpErr.Code != codeInvalidParams {
+		t.Fatalf("expected a %d error, got %+v", codeInvalidParams, result.Content)
+	}
+}
+
+func TestQuerySongsLimitAndOffset(t *testing.T) {
+	server := NewServer()
+
+	page := func(args map[string]interface{}) []interface{} {
+		t.Helper()
+		result := server.ExecuteTool(context.Background(), ToolInvocation{Name: "query_songs", Arguments: args})
+		if result.IsError {
+			t.Fatalf("%v: unexpected error %v", args, result.Content)
+		}
+		var ids []interface{}
+		for _, row := range result.Content.(*QueryResult).Rows {
+			ids = append(ids, row[0])
+		}
+		return ids
+	}
+
+	if ids := page(map[string]interface{}{"limit": 2.0, "offset": 3.0}); len(ids) != 2 || ids[0] != "SONG004" {
+		t.Errorf("expected SONG004 and SONG005, got %v", ids)
+	}
+	if ids := page(map[string]interface{}{"offset": 50.0}); len(ids) != 0 {
+		t.Errorf("expected no songs past the end, got %v", ids)
+	}
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{Name: "query_songs", Arguments: map[string]interface{}{"offset": 1e19}})
+	if mcpErr, ok := result.Content.(*MCPError); !result.IsError || !ok || mcpErr.Code != codeInvalidParams {
+		t.Errorf("expected a %d error for an oversized offset, got %+v", codeInvalidParams, result.Content)
+	}
+}
+
+func TestQuerySongsWithAlbumFilters(t *testing.T) {
+	server := NewServer()
+
+	for _, tc := range []struct {
+		args map[string]interface{}
+		want int
+	}{
+		{map[string]interface{}{}, 20},
+		{map[string]interface{}{"album_id": "alb005"}, 5},
+		{map[string]interface{}{"era": "synth pop"}, 2},
+	} {
+		result := server.ExecuteTool(context.Background(), ToolInvocation{Name: "query_songs_with_album", Arguments: tc.args})
+		if result.IsError {
+			t.Fatalf("%v: unexpected error %v", tc.args, result.Content)
+		}
+		if qr := result.Content.(*QueryResult); qr.RowCount != tc.want {
+			t.Errorf("%v: expected %d songs, got %d", tc.args, tc.want, qr.RowCount)
+		}
+	}
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "query_songs_with_album",
+		Arguments: map[string]interface{}{"era": "Disco"},
+	})
+	if mcpErr, ok := result.Content.(*MCPError); !result.IsError || !ok || mcpErr.Code != -32602 {
+		t.Errorf("expected -32602 for an unknown era, got %+v", result.Content)
+	}
+}
+
+func TestTopSongsLimitEdgeCases(t *testing.T) {
+	server := NewServer()
+
+	for _, tc := range []struct {
+		limit float64
+		want  int
+	}{
+		{3, 3},
+		{0, 10},
+		{-4, 10},
+		{500, 20},
+	} {
+		result := server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "top_songs",
+			Arguments: map[string]interface{}{"limit": tc.limit},
+		})
+		if result.IsError {
+			t.Fatalf("limit %v: unexpected error %v", tc.limit, result.Content)
+		}
+		songs := result.Content.(map[string]interface{})["songs"].([]map[string]interface{})
+		if len(songs) != tc.want {
+			t.Errorf("limit %v: expected %d songs, got %d", tc.limit, tc.want, len(songs))
+		}
+		for i := 1; i < len(songs); i++ {
+			if songs[i-1]["streams_millions"].(int64) < songs[i]["streams_millions"].(int64) {
+				t.Errorf("limit %v: songs not sorted by streams at rank %d", tc.limit, i+1)
+			}
+		}
+	}
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "top_songs",
+		Arguments: map[string]interface{}{"limit": 1e20},
+	})
+	if mcpErr, ok := result.Content.(*MCPError); !result.IsError || !ok || mcpErr.Code != -32602 {
+		t.Errorf("limit 1e20: expected -32602, got %+v", result.Content)
+	}
+}
+
+func TestCompareToursResolvesIDsAndNames(t *testing.T) {
+	server := NewServer()
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "compare_tours",
+		Arguments: map[string]interface{}{"tour_a": "eras", "tour_b": "tour001"},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error %v", result.Content)
+	}
+	content := result.Content.(map[string]interface{})
+	a := content["tour_a"].(map[string]interface{})
+	b := content["tour_b"].(map[string]interface{})
+	if a["id"] != "TOUR006" || b["id"] != "TOUR001" {
+		t.Fatalf("expected TOUR006 vs TOUR001, got %v vs %v", a["id"], b["id"])
+	}
+	if got := a["metrics"].(map[string]float64)["revenue_per_show_millions"]; got != 13.158 {
+		t.Errorf("expected 13.158M revenue per show for The Eras Tour, got %v", got)
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"tour_a": "Eras", "tour_b": "TOUR006"},
+		{"tour_a": "Tour", "tour_b": "TOUR001"},
+		{"tour_a": "Folklore", "tour_b": "TOUR001"},
+		{"tour_a": "TOUR001"},
+	} {
+		result := server.ExecuteTool(context.Background(), ToolInvocation{Name: "compare_tours", Arguments: args})
+		if mcpErr, ok := result.Content.(*MCPError); !result.IsError || !ok || mcpErr.Code != -32602 {
+			t.Errorf("%v: expected -32602, got %+v", args, result.Content)
+		}
+	}
+}
+
+func TestStreamingQueryBatchSize(t *testing.T) {
+	server := NewServer()
+
+	batches := 0
+	ctx := withProgress(context.Background(), func(map[string]interface{}) { batches++ })
+	result := server.ExecuteTool(ctx, ToolInvocation{
+		Name:      "streaming_query",
+		Arguments: map[string]interface{}{"table": "songs", "batch_size": float64(7)},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error %v", result.Content)
+	}
+	if got := result.Content.(map[string]interface{})["batches"]; got != 3 || batches != 3 {
+		t.Errorf("expected 20 songs in 3 batches of 7, got %v (%d progress updates)", got, batches)
+	}
+
+	for _, size := range []float64{0, -5, 1001, 2.5} {
+		result := server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "streaming_query",
+			Arguments: map[string]interface{}{"table": "songs", "batch_size": size},
+		})
+		if mcpErr, ok := result.Content.(*MCPError); !result.IsError || !ok || mcpErr.Code != -32602 {
+			t.Errorf("batch_size %v: expected -32602, got %+v", size, result.Content)
+		}
+	}
+}
+
+func TestStreamingQueryRejectsUnknownTable(t *testing.T) {
+	server := NewServer()
+
+	for _, table := range []string{"songs WHERE streams > 2500 ORDER BY streams DESC", "setlists"} {
+		result := server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "streaming_query",
+			Arguments: map[string]interface{}{"table": table},
+		})
+		mcpErr, ok := result.Content.(*MCPError)
+		if !result.IsError || !ok || mcpErr.Code != -32602 {
+			t.Fatalf("%q: expected -32602, got %+v", table, result.Content)
+		}
+		if data, ok := mcpErr.Data.(*ArgumentError); !ok || len(data.ValidOptions) != 3 {
+			t.Errorf("%q: expected the valid tables in the error data, got %+v", table, mcpErr.Data)
+		}
+	}
+}
+
+func TestExportChunkOutOfRangeIndex(t *testing.T) {
+	server := NewServer()
+	export := func(index float64) ToolResult {
+		return server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "export_chunk",
+			Arguments: map[string]interface{}{"chunk_index": index, "chunk_size": float64(100)},
+		})
+	}
+
+	// the whole dataset fits in one chunk of 100, so index 1 is the empty
+	// final chunk and index 2 is out of range
+	result := export(1)
+	if result.IsError {
+		t.Fatalf("unexpected error %v", result.Content)
+	}
+	content := result.Content.(map[string]interface{})
+	if content["total_chunks"] != 1 || content["row_count"] != 0 || content["has_more"] != false {
+		t.Errorf("expected an empty final chunk of 1, got %v", content)
+	}
+
+	result = export(2)
+	if mcpErr, ok := result.Content.(*MCPError); !result.IsError || !ok || mcpErr.Code != -32602 {
+		t.Errorf("expected -32602 past the final chunk, got %+v", result.Content)
+	}
+}
+
+func TestTourProjectionValidatesYear(t *testing.T) {
+	server := NewServer()
+
+	result := server.ExecuteTool(context.Background(), ToolInvocation{
+		Name:      "tour_projection",
+		Arguments: map[string]interface{}{"attendance": float64(1000000), "year": float64(2026)},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error %v", result.Content)
+	}
+
+	for _, year := range []float64{2026.5, -2026, 1e20, 1990} {
+		result := server.ExecuteTool(context.Background(), ToolInvocation{
+			Name:      "tour_projection",
+			Arguments: map[string]interface{}{"attendance": float64(1000000), "year": year},
+		})
+		if mcpErr, ok := result.Content.(*MCPError); !result.IsError || !ok || mcpErr.Code != -32602 {
+			t.Errorf("year %v: expected -32602, got %+v", year, result.Content)
+		}
+	}
+}
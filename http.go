@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sessionHeader carries the id of a Streamable HTTP session. It is issued in
+// the reply to initialize and sent back by the client on later requests.
+const sessionHeader = "Mcp-Session-Id"
+
+// HTTP sessions, by id. Each POST is its own request, so this is what
+// carries initialize and the negotiated response version between them.
+var httpSessions = newHTTPSessionRegistry()
+
+type httpSessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newHTTPSessionRegistry() *httpSessionRegistry {
+	return &httpSessionRegistry{sessions: make(map[string]*session)}
+}
+
+// add registers s, first dropping any sessions that have gone idle so
+// clients that never DELETE theirs don't accumulate
+func (r *httpSessionRegistry) add(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, old := range r.sessions {
+		if old.idleFor() > idleTimeout {
+			delete(r.sessions, id)
+		}
+	}
+	r.sessions[s.id] = s
+}
+
+// get returns the session with id. Sessions idle for longer than
+// idleTimeout are dropped and no longer found.
+func (r *httpSessionRegistry) get(id string) (*session, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if ok && s.idleFor() > idleTimeout {
+		delete(r.sessions, id)
+		return nil, false
+	}
+	return s, ok
+}
+
+// remove ends the session with id, reporting whether it existed
+func (r *httpSessionRegistry) remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.sessions[id]
+	delete(r.sessions, id)
+	return ok
+}
+
+// handleMCPHTTP serves the Streamable HTTP transport: each POST carries one
+// JSON-RPC request or a batch of them, dispatched through the same worker
+// queue as WebSocket requests. Tool calls that stream progress are answered
+// with a text/event-stream when the client accepts one, with an SSE event
+// per partial result and the response as the last event; everything else
+// gets a single JSON response, or an array of them for a batch. DELETE ends
+// a session.
+func handleMCPHTTP(w http.ResponseWriter, r *http.Request, server *Server) {
+	if r.Method == http.MethodDelete {
+		if !httpSessions.remove(r.Header.Get(sessionHeader)) {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var batch []MCPRequest
+	if isBatch(body) {
+		err = json.Unmarshal(body, &batch)
+	} else {
+		var req MCPRequest
+		err = json.Unmarshal(body, &req)
+		batch = []MCPRequest{req}
+	}
+	if err != nil {
+		writeHTTPJSON(w, http.StatusBadRequest, MCPResponse{
+			JSONRPC: "2.0",
+			Error:   newMCPError(codeInvalidRequest, "Invalid Request", map[string]string{"detail": err.Error()}),
+		})
+		return
+	}
+
+	var sess *session
+	if id := r.Header.Get(sessionHeader); id != "" {
+		var ok bool
+		if sess, ok = httpSessions.get(id); !ok {
+			http.Error(w, "unknown or expired session", http.StatusNotFound)
+			return
+		}
+	} else {
+		// Responses go in the HTTP reply, never through the session
+		sess = newStreamSession(io.Discard)
+		sess.setClientID(r.Header.Get("X-Client-ID"))
+		for _, req := range batch {
+			if req.Method == "initialize" {
+				httpSessions.add(sess)
+				w.Header().Set(sessionHeader, sess.id)
+				break
+			}
+		}
+	}
+	sess.touch()
+
+	if isBatch(body) {
+		serveBatch(w, r, sess, batch, server)
+		return
+	}
+	req := batch[0]
+
+	if req.isNotification() {
+		response, invocation := awaitRequest(r.Context(), sess, req, server)
+		logHTTPError(sess, req, invocation, response)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if req.Method == "tools/call" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		var invocation ToolInvocation
+		if json.Unmarshal(req.Params, &invocation) == nil && server.streamsProgress(invocation.Name) {
+			if flusher, ok := w.(http.Flusher); ok {
+				serveEventStream(w, flusher, r, sess, req, server)
+				return
+			}
+		}
+	}
+
+	response, invocation := awaitRequest(r.Context(), sess, req, server)
+	logHTTPError(sess, req, invocation, response)
+	writeHTTPJSON(w, http.StatusOK, response)
+}
+
+// awaitRequest dispatches req and waits for its response
+func awaitRequest(ctx context.Context, sess *session, req MCPRequest, server *Server) (response MCPResponse, invocation ToolInvocation) {
+	done := make(chan struct{})
+	dispatchRequest(ctx, sess, req, server, func(r MCPResponse, i ToolInvocation) {
+		response, invocation = r, i
+		close(done)
+	})
+	<-done
+	return response, invocation
+}
+
+// serveBatch answers a JSON-RPC batch with an array of responses, as
+// handleBatch does for WebSocket sessions. A batch of only notifications
+// gets 202 and no body.
+func serveBatch(w http.ResponseWriter, r *http.Request, sess *session, batch []MCPRequest, server *Server) {
+	if mcpErr := checkBatch(batch, server); mcpErr != nil {
+		logErrorResponse(sess.id, MCPRequest{}, ToolInvocation{}, mcpErr)
+		writeHTTPJSON(w, http.StatusBadRequest, MCPResponse{JSONRPC: "2.0", Error: mcpErr})
+		return
+	}
+
+	wait := startBatch(sess, batch, server, func(MCPRequest) context.Context {
+		return r.Context()
+	})
+	replies := wait()
+	if len(replies) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, replies)
+}
+
+// serveEventStream runs req, sending each progress update as an SSE event as
+// it happens and the response as the final event.
+func serveEventStream(w http.ResponseWriter, flusher http.Flusher, r *http.Request, sess *session, req MCPRequest, server *Server) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("[ERROR] Failed to encode event: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	ctx := withProgress(r.Context(), func(update map[string]interface{}) {
+		send(progressNotification(req.ID, update))
+	})
+	response, invocation := awaitRequest(ctx, sess, req, server)
+	logHTTPError(sess, req, invocation, response)
+	send(response)
+}
+
+// logHTTPError logs an error response the way sendResponse does for
+// WebSocket sessions
+func logHTTPError(sess *session, req MCPRequest, invocation ToolInvocation, response MCPResponse) {
+	if response.Error != nil {
+		logErrorResponse(sess.id, req, invocation, response.Error)
+	}
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[ERROR] Failed to send response: %v", err)
+	}
+}
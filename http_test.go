@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postMCP sends body to the Streamable HTTP endpoint of ts
+func postMCP(t *testing.T, ts *httptest.Server, sessionID, accept, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/mcp", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("bad request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if sessionID != "" {
+		req.Header.Set(sessionHeader, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decodeHTTPResponse(t *testing.T, resp *http.Response) MCPResponse {
+	t.Helper()
+
+	var out MCPResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return out
+}
+
+func TestHTTPTransportKeepsSessionState(t *testing.T) {
+	ts := httptest.NewServer(newRouter(NewServer(), ""))
+	t.Cleanup(ts.Close)
+
+	call := `{"jsonrpc":"2.0","id":"call","method":"tools/call","params":{"name":"list_tables","arguments":{}}}`
+	if resp := decodeHTTPResponse(t, postMCP(t, ts, "", "", call)); resp.Error == nil || resp.Error.Code != codeNotInitialized {
+		t.Errorf("expected %d without a session, got %+v", codeNotInitialized, resp.Error)
+	}
+
+	init := postMCP(t, ts, "", "", `{"jsonrpc":"2.0","id":"init","method":"initialize","params":{}}`)
+	id := init.Header.Get(sessionHeader)
+	if id == "" {
+		t.Fatal("initialize reply carried no session id")
+	}
+
+	resp := postMCP(t, ts, id, "application/json, text/event-stream", call)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a plain JSON reply for a non-streaming tool, got %s", ct)
+	}
+	if out := decodeHTTPResponse(t, resp); out.Error != nil || out.ID != "call" {
+		t.Errorf("unexpected response %+v", out)
+	}
+
+	if resp := postMCP(t, ts, "no-such-session", "", call); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %d", resp.StatusCode)
+	}
+	if resp := postMCP(t, ts, id, "", `{"jsonrpc":"2.0","method":"notifications/initialized"}`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 for a notification, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPTransportStreamsBatchesAsEvents(t *testing.T) {
+	ts := httptest.NewServer(newRouter(NewServer(), ""))
+	t.Cleanup(ts.Close)
+
+	init := postMCP(t, ts, "", "", `{"jsonrpc":"2.0","id":"init","method":"initialize","params":{}}`)
+	id := init.Header.Get(sessionHeader)
+
+	resp := postMCP(t, ts, id, "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":"stream","method":"tools/call","params":{"name":"streaming_query","arguments":{"table":"albums"}}}`)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s", ct)
+	}
+
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("bad event %q: %v", data, err)
+		}
+		events = append(events, event)
+	}
+
+	// 11 albums in batches of 5, then the response
+	if len(events) != 4 {
+		t.Fatalf("expected 3 progress events and a response, got %d: %v", len(events), events)
+	}
+	for _, event := range events[:3] {
+		if event["method"] != "notifications/progress" {
+			t.Errorf("expected a progress notification, got %v", event)
+		}
+	}
+	if last := events[3]; last["id"] != "stream" || last["result"] == nil {
+		t.Errorf("expected the response last, got %v", last)
+	}
+}
+
+func TestHTTPTransportAnswersBatches(t *testing.T) {
+	server := NewServer()
+	server.maxBatchSize = 3
+	ts := httptest.NewServer(newRouter(server, ""))
+	t.Cleanup(ts.Close)
+
+	init := postMCP(t, ts, "", "", `{"jsonrpc":"2.0","id":"init","method":"initialize","params":{}}`)
+	id := init.Header.Get(sessionHeader)
+
+	resp := postMCP(t, ts, id, "", `[
+		{"jsonrpc":"2.0","id":"first","method":"tools/call","params":{"name":"list_tables","arguments":{}}},
+		{"jsonrpc":"2.0","method":"notifications/initialized"},
+		{"jsonrpc":"2.0","id":"second","method":"ping"}
+	]`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for a batch, got %d", resp.StatusCode)
+	}
+	var replies []MCPResponse
+	if err := json.NewDecoder(resp.Body).Decode(&replies); err != nil {
+		t.Fatalf("expected an array of responses: %v", err)
+	}
+	if len(replies) != 2 || replies[0].ID != "first" || replies[1].ID != "second" {
+		t.Fatalf("expected replies for first and second (none for the notification), got %+v", replies)
+	}
+	if replies[0].Error != nil {
+		t.Errorf("unexpected error %+v", replies[0].Error)
+	}
+
+	if resp := postMCP(t, ts, id, "", `[{"jsonrpc":"2.0","method":"notifications/initialized"}]`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 for a batch of only notifications, got %d", resp.StatusCode)
+	}
+
+	oversized := postMCP(t, ts, id, "", `[
+		{"jsonrpc":"2.0","id":"1","method":"ping"},
+		{"jsonrpc":"2.0","id":"2","method":"ping"},
+		{"jsonrpc":"2.0","id":"3","method":"ping"},
+		{"jsonrpc":"2.0","id":"4","method":"ping"}
+	]`)
+	if out := decodeHTTPResponse(t, oversized); out.Error == nil || out.Error.Code != codeInvalidRequest {
+		t.Errorf("expected %d for an oversized batch, got %+v", codeInvalidRequest, out.Error)
+	}
+}
+
+func TestHTTPTransportSharesWorkerQueue(t *testing.T) {
+	server := NewServer()
+	server.pool = newWorkerPool(1, 0)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	err := server.tools.register(toolSpec{
+		name: "block",
+		handler: func(s *Server, ctx context.Context, args map[string]interface{}) ToolResult {
+			close(started)
+			<-release
+			return ToolResult{Content: "done"}
+		},
+	})
+	if err != nil {
+		t.Fatalf("register block: %v", err)
+	}
+
+	ts := httptest.NewServer(newRouter(server, ""))
+	t.Cleanup(ts.Close)
+
+	init := postMCP(t, ts, "", "", `{"jsonrpc":"2.0","id":"init","method":"initialize","params":{}}`)
+	id := init.Header.Get(sessionHeader)
+
+	// postMCP can't fail the test from another goroutine, so post directly
+	blocked := make(chan MCPResponse, 1)
+	go func() {
+		var out MCPResponse
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/mcp",
+			strings.NewReader(`{"jsonrpc":"2.0","id":"slow","method":"tools/call","params":{"name":"block","arguments":{}}}`))
+		req.Header.Set(sessionHeader, id)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			json.NewDecoder(resp.Body).Decode(&out)
+			resp.Body.Close()
+		}
+		blocked <- out
+	}()
+	<-started
+
+	busy := decodeHTTPResponse(t, postMCP(t, ts, id, "", `{"jsonrpc":"2.0","id":"extra","method":"tools/call","params":{"name":"list_tables","arguments":{}}}`))
+	if busy.Error == nil || busy.Error.Code != codeServerBusy {
+		t.Errorf("expected %d while the only worker is busy, got %+v", codeServerBusy, busy.Error)
+	}
+
+	close(release)
+	if out := <-blocked; out.Error != nil || out.ID != "slow" {
+		t.Errorf("unexpected response %+v", out)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyArg is the tool argument clients use to make a call
+// idempotent. It is consumed by ExecuteTool and never reaches a handler.
+const idempotencyKeyArg = "idempotency_key"
+
+// idempotencyCache remembers successful tool results by client-supplied key
+// so a retried call returns the original result instead of running again.
+// It is shared by all connections, bounded to maxEntries, and entries expire
+// after ttl. Failed results are not kept, so a failed call can be retried.
+// Each entry remembers a hash of the arguments it ran with, so a key reused
+// for a different call is rejected rather than answered with a stale result.
+type idempotencyCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	// argsHash identifies the arguments the entry's call ran with
+	argsHash string
+	// done is closed once result is set, or once the call is abandoned
+	done chan struct{}
+	// abandoned reports that fn panicked, so there is no result to share
+	abandoned bool
+	result    ToolResult
+	expires   time.Time
+}
+
+// errIdempotencyKeyReused is returned by do for a key already used with
+// different arguments.
+var errIdempotencyKeyReused = errors.New("idempotency key reused with different arguments")
+
+// argumentsHash fingerprints a call's arguments. encoding/json sorts map
+// keys, so equal arguments always hash the same.
+func argumentsHash(args map[string]interface{}) string {
+	data, err := json.Marshal(args)
+	if err != nil {
+		// unencodable arguments can't be compared, so never match them
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func newIdempotencyCache(ttl time.Duration, maxEntries int) *idempotencyCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &idempotencyCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*idempotencyEntry),
+	}
+}
+
+// do returns the cached result for key, or runs fn and caches its result.
+// Concurrent calls with the same key wait for the first one instead of
+// running fn again, giving up with ctx's error if ctx is done first; if the
+// first call panics, the next caller runs fn itself. A key whose entry was
+// made with a different argsHash fails with errIdempotencyKeyReused. cached
+// reports whether fn was skipped.
+func (c *idempotencyCache) do(ctx context.Context, key, argsHash string, fn func() ToolResult) (result ToolResult, cached bool, err error) {
+	for {
+		now := time.Now()
+
+		c.mu.Lock()
+		entry, ok := c.entries[key]
+		if ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+			c.mu.Unlock()
+			if entry.argsHash == "" || entry.argsHash != argsHash {
+				return ToolResult{}, false, errIdempotencyKeyReused
+			}
+			select {
+			case <-entry.done:
+			case <-ctx.Done():
+				return ToolResult{}, false, ctx.Err()
+			}
+			if entry.abandoned {
+				continue
+			}
+			return entry.result, true, nil
+		}
+
+		entry = &idempotencyEntry{argsHash: argsHash, done: make(chan struct{})}
+		c.makeRoom(now)
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		return c.run(key, entry, fn), false, nil
+	}
+}
+
+// run calls fn for entry, the in-flight entry for key, and records its
+// result. If fn panics, the entry is removed and marked abandoned before
+// the panic continues, so waiters don't block on it forever.
+func (c *idempotencyCache) run(key string, entry *idempotencyEntry, fn func() ToolResult) ToolResult {
+	finished := false
+	defer func() {
+		if finished {
+			return
+		}
+		c.mu.Lock()
+		entry.abandoned = true
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		close(entry.done)
+	}()
+
+	result := fn()
+	finished = true
+
+	c.mu.Lock()
+	entry.result = result
+	if result.IsError {
+		delete(c.entries, key)
+	} else {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+	close(entry.done)
+
+	return result
+}
+
+// makeRoom drops expired entries and, if the cache is still full, the entry
+// closest to expiry. In-flight entries are never evicted. c.mu must be held.
+func (c *idempotencyCache) makeRoom(now time.Time) {
+	for key, entry := range c.entries {
+		if !entry.expires.IsZero() && !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	for len(c.entries) >= c.maxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if entry.expires.IsZero() {
+				continue
+			}
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = key, entry.expires
+			}
+		}
+		if oldestKey == "" {
+			return
+		}
+		delete(c.entries, oldestKey)
+	}
+}
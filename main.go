@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -21,6 +27,21 @@ var (
 		CheckOrigin: func(r *http.Request) bool { return true },
 	}
 
+	// Open connections, closed with a goodbye frame on shutdown
+	sessions = newSessionRegistry()
+
+	// Connections idle for longer than this are reaped
+	idleTimeout = 5 * time.Minute
+
+	// Largest client message accepted, after reassembling any fragments
+	maxMessageBytes int64 = 1 << 20
+
+	// Responses a connection may have outstanding before its reads pause
+	maxPendingWrites = 32
+
+	// Tool-call metrics broken down by client id
+	clientStats = newClientMetrics()
+
 	// Metrics
 	queriesExecuted  atomic.Int64
 	totalLatency     atomic.Int64
@@ -32,6 +53,10 @@ type Metrics struct {
 	AvgLatencyMS     float64 `json:"avg_latency_ms"`
 	ActiveGoroutines int32   `json:"active_goroutines"`
 	UptimeSeconds    int64   `json:"uptime_seconds"`
+	QueueDepth       int     `json:"queue_depth"`
+
+	Clients map[string]ClientMetrics `json:"clients"`
+	Tools   map[string]ToolStats     `json:"tools"`
 }
 
 var startTime time.Time
@@ -39,6 +64,15 @@ var startTime time.Time
 func main() {
 	startTime = time.Now()
 
+	defaultTransport := "websocket"
+	if envBool("STDIO", false) {
+		defaultTransport = "stdio"
+	}
+	transport := flag.String("transport", defaultTransport, "how clients connect: websocket or stdio")
+	flag.Parse()
+
+	// Logs go to stderr so they never mix with the stdio protocol stream
+	log.SetOutput(os.Stderr)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 	log.Println("[INFO] 🎤 MCP Swiftie Server starting...")
 
@@ -49,16 +83,41 @@ func main() {
 	log.Printf("[INFO] Registered %d tools: %v", len(tools), getToolNames(tools))
 
 	// HTTP handlers
-	http.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
-		handleMCPConnection(w, r, server)
-	})
+	basePath := normalizeBasePath(os.Getenv("BASE_PATH"))
+	router := newRouter(server, basePath)
+
+	if raw := os.Getenv("IDLE_TIMEOUT"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			idleTimeout = d
+		} else {
+			log.Printf("[WARN] Ignoring invalid IDLE_TIMEOUT=%q, using %v", raw, idleTimeout)
+		}
+	}
 
-	http.HandleFunc("/metrics", handleMetrics)
+	maxMessageBytes = int64(envInt("MAX_MESSAGE_BYTES", int(maxMessageBytes)))
+	maxPendingWrites = envInt("MAX_PENDING_WRITES", maxPendingWrites)
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-	})
+	if raw := os.Getenv("COLUMN_PRECISION"); raw != "" {
+		if precision, err := parseColumnPrecision(raw); err == nil {
+			columnPrecision = precision
+		} else {
+			log.Printf("[WARN] Ignoring invalid COLUMN_PRECISION=%q: %v", raw, err)
+		}
+	}
+
+	switch *transport {
+	case "stdio":
+		log.Println("[INFO] Serving MCP over stdio ✨")
+		if err := serveStdio(server, os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("[ERROR] Stdio transport failed: %v", err)
+		}
+		flushMetrics(snapshotMetrics(server), os.Getenv("METRICS_FLUSH_URL"))
+		log.Println("[INFO] Server exited")
+		return
+	case "websocket":
+	default:
+		log.Fatalf("[ERROR] Unknown transport %q (use websocket or stdio)", *transport)
+	}
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -67,11 +126,11 @@ func main() {
 	}
 
 	addr := fmt.Sprintf(":%s", port)
-	log.Printf("[INFO] Server listening on %s", addr)
+	log.Printf("[INFO] Server listening on %s%s", addr, basePath)
 	log.Println("[INFO] Ready for connections ✨")
 
 	// Graceful shutdown
-	srv := &http.Server{Addr: addr}
+	srv := &http.Server{Addr: addr, Handler: router}
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -86,6 +145,8 @@ func main() {
 
 	log.Println("[INFO] Shutting down server...")
 
+	sessions.closeAll(websocket.CloseGoingAway, "server shutting down")
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -93,9 +154,47 @@ func main() {
 		log.Fatalf("[ERROR] Server forced to shutdown: %v", err)
 	}
 
+	flushMetrics(snapshotMetrics(server), os.Getenv("METRICS_FLUSH_URL"))
+
 	log.Println("[INFO] Server exited")
 }
 
+// newRouter registers all HTTP routes under basePath.
+func newRouter(server *Server, basePath string) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// WebSocket clients upgrade with a GET; Streamable HTTP clients POST
+	mux.HandleFunc(basePath+"/mcp", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodDelete:
+			handleMCPHTTP(w, r, server)
+		default:
+			handleMCPConnection(w, r, server)
+		}
+	})
+
+	mux.HandleFunc(basePath+"/metrics", func(w http.ResponseWriter, r *http.Request) {
+		handleMetrics(w, r, server)
+	})
+
+	mux.HandleFunc(basePath+"/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	})
+
+	return mux
+}
+
+// normalizeBasePath turns "swiftie/", "/swiftie" or "/swiftie/" into
+// "/swiftie", and "" or "/" into "".
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
 func handleMCPConnection(w http.ResponseWriter, r *http.Request, server *Server) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -104,93 +203,418 @@ func handleMCPConnection(w http.ResponseWriter, r *http.Request, server *Server)
 	}
 	defer conn.Close()
 
-	log.Printf("[INFO] New MCP connection from %s", r.RemoteAddr)
+	// Fragmented messages are reassembled by the reader; the limit applies to
+	// the whole message, and oversized ones close the connection with 1009
+	conn.SetReadLimit(maxMessageBytes)
+
+	sess := newSession(conn)
+	sess.setClientID(r.Header.Get("X-Client-ID"))
+	log.Printf("[INFO] New MCP connection %s from %s (client %s)", sess.id, r.RemoteAddr, sess.getClientID())
+	sessions.add(sess)
+	defer sessions.remove(sess)
+
+	done := make(chan struct{})
+	defer close(done)
+	go sess.reapIdle(idleTimeout, done)
 
 	// Send server info
 	serverInfo := MCPResponse{
 		JSONRPC: "2.0",
 		ID:      uuid.New().String(),
-		Result: map[string]interface{}{
-			"protocolVersion": "0.1.0",
-			"serverInfo": map[string]string{
-				"name":    "mcp-swiftie-server",
-				"version": "1.0.0",
-			},
-			"capabilities": map[string]interface{}{
-				"tools": map[string]interface{}{},
-			},
-		},
+		Result:  serverInfoResult(sess.getResponseVersion()),
 	}
 
-	if err := conn.WriteJSON(serverInfo); err != nil {
+	if err := sess.writeJSON(serverInfo); err != nil {
 		log.Printf("[ERROR] Failed to send server info: %v", err)
 		return
 	}
 
 	// Handle requests
 	for {
-		var req MCPRequest
-		if err := conn.ReadJSON(&req); err != nil {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("[ERROR] WebSocket error: %v", err)
 			}
 			break
 		}
+		sess.touch()
+
+		if err := dispatchMessage(sess, data, server); err != nil {
+			log.Printf("[ERROR] Malformed message from %s (client %s): %v", r.RemoteAddr, sess.getClientID(), err)
+			break
+		}
+	}
+
+	log.Printf("[INFO] Connection closed from %s (client %s)", r.RemoteAddr, sess.getClientID())
+}
+
+// dispatchMessage decodes one client message, a request or a batch of them,
+// and hands it off for processing. It only reports messages that aren't
+// valid JSON-RPC; responses are written as the requests complete.
+func dispatchMessage(sess *session, data []byte, server *Server) error {
+	// A JSON array is a batch of requests answered with one array
+	if isBatch(data) {
+		var batch []MCPRequest
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return err
+		}
+		handleBatch(sess, batch, server)
+		return nil
+	}
+
+	var req MCPRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+
+	// Wait for the client to drain responses before taking on more work
+	inline := runsInline(req.Method)
+	if !inline {
+		sess.reserveWrite()
+	}
+	dispatchRequest(sess.progressContext(context.Background(), req), sess, req, server, func(response MCPResponse, invocation ToolInvocation) {
+		sendResponse(sess, req, invocation, response)
+		if !inline {
+			sess.releaseWrite()
+		}
+	})
+	return nil
+}
+
+// isBatch reports whether data is a JSON array, which JSON-RPC treats as a
+// batch of requests
+func isBatch(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// dispatchRequest runs req under ctx and passes its response to done. Most
+// requests are queued for a worker, and are answered with busyResponse if
+// the queue is full; those that runsInline are handled before it returns.
+// Every transport dispatches through here so all of them share the queue.
+func dispatchRequest(ctx context.Context, sess *session, req MCPRequest, server *Server, done func(MCPResponse, ToolInvocation)) {
+	// Keepalives skip the worker queue so they stay prompt under load, and
+	// initialize runs inline so it completes before any request behind it
+	if runsInline(req.Method) {
+		done(processRequest(ctx, sess, req, server))
+		return
+	}
+
+	job := func() {
+		done(processRequest(ctx, sess, req, server))
+	}
+	if !server.pool.Submit(job) {
+		done(busyResponse(sess, req, server), ToolInvocation{})
+	}
+}
+
+// runsInline reports whether method is handled on the read loop rather than
+// queued for a worker. Cancellations must not wait behind the very calls
+// they are cancelling.
+func runsInline(method string) bool {
+	return method == "ping" || method == "initialize" || method == "notifications/cancelled"
+}
+
+// busyResponse rejects req because the worker queue is full
+func busyResponse(sess *session, req MCPRequest, server *Server) MCPResponse {
+	log.Printf("[WARN] Request queue full, rejecting %s on %s (client %s)", req.Method, sess.id, sess.getClientID())
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error: newMCPError(codeServerBusy, "Server busy: request queue is full", map[string]interface{}{
+			"queue_depth": server.pool.QueueDepth(),
+		}),
+	}
+}
+
+// handleBatch dispatches each request of a JSON-RPC batch the way a single
+// request would be, then writes their responses as one array in request
+// order. Notifications get no element, and a batch of only notifications
+// gets no reply at all.
+func handleBatch(sess *session, batch []MCPRequest, server *Server) {
+	if mcpErr := checkBatch(batch, server); mcpErr != nil {
+		// not sent through sendResponse, which would drop it for lacking an id
+		logErrorResponse(sess.id, MCPRequest{}, ToolInvocation{}, mcpErr)
+		if err := sess.writeJSON(MCPResponse{JSONRPC: "2.0", Error: mcpErr}); err != nil {
+			log.Printf("[ERROR] Failed to send response: %v", err)
+		}
+		return
+	}
+
+	sess.reserveWrite()
+
+	wait := startBatch(sess, batch, server, func(req MCPRequest) context.Context {
+		return sess.progressContext(context.Background(), req)
+	})
+	go func() {
+		defer sess.releaseWrite()
+		replies := wait()
+		if len(replies) == 0 {
+			return
+		}
+		if err := sess.writeJSON(replies); err != nil {
+			log.Printf("[ERROR] Failed to send batch response: %v", err)
+		}
+	}()
+}
 
-		go handleMCPRequest(conn, req, server)
+// checkBatch rejects a batch that is empty or larger than maxBatchSize, in
+// which case none of its requests run
+func checkBatch(batch []MCPRequest, server *Server) *MCPError {
+	if len(batch) == 0 {
+		return newMCPError(codeInvalidRequest, "Invalid Request: empty batch", nil)
 	}
+	if n := len(batch); n > server.maxBatchSize {
+		return newMCPError(codeInvalidRequest,
+			fmt.Sprintf("batch of %d tool calls exceeds the limit of %d", n, server.maxBatchSize),
+			map[string]int{"batch_size": n, "max_batch_size": server.maxBatchSize})
+	}
+	return nil
+}
+
+// startBatch dispatches every request of batch, each under the context
+// contextFor gives it. The returned func waits for them all and returns
+// their responses in request order, leaving out notifications and logging
+// any errors among the rest.
+func startBatch(sess *session, batch []MCPRequest, server *Server, contextFor func(MCPRequest) context.Context) func() []MCPResponse {
+	responses := make([]MCPResponse, len(batch))
+	invocations := make([]ToolInvocation, len(batch))
+	var wg sync.WaitGroup
+	for i, req := range batch {
+		i := i
+		wg.Add(1)
+		dispatchRequest(contextFor(req), sess, req, server, func(response MCPResponse, invocation ToolInvocation) {
+			responses[i], invocations[i] = response, invocation
+			wg.Done()
+		})
+	}
+
+	return func() []MCPResponse {
+		wg.Wait()
 
-	log.Printf("[INFO] Connection closed from %s", r.RemoteAddr)
+		replies := make([]MCPResponse, 0, len(batch))
+		for i, req := range batch {
+			if req.isNotification() {
+				continue
+			}
+			if responses[i].Error != nil {
+				logErrorResponse(sess.id, req, invocations[i], responses[i].Error)
+			}
+			replies = append(replies, responses[i])
+		}
+		return replies
+	}
 }
 
-func handleMCPRequest(conn *websocket.Conn, req MCPRequest, server *Server) {
+// processRequest runs req and returns its response, along with the tool
+// invocation it carried (if any) for error logging. Tool calls run under
+// ctx, bounded by the tool timeout. A panic while handling req becomes an
+// internal error response, so the client still gets an answer.
+func processRequest(ctx context.Context, sess *session, req MCPRequest, server *Server) (response MCPResponse, invocation ToolInvocation) {
 	activeGoroutines.Add(1)
 	defer activeGoroutines.Add(-1)
 
 	start := time.Now()
 
-	var response MCPResponse
 	response.JSONRPC = "2.0"
 	response.ID = req.ID
 
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[ERROR] Panic handling %s (tool %q) on %s: %v\n%s", req.Method, invocation.Name, sess.id, r, debug.Stack())
+			if invocation.Name != "" {
+				server.recordOutcome(invocation.Name, true)
+			}
+			response.Result = nil
+			response.Error = newMCPError(codeInternalError, fmt.Sprintf("Internal error while running %s", describeCall(req, invocation)),
+				map[string]string{"method": req.Method, "tool": invocation.Name})
+		}
+	}()
+
+	// Tools are only available once the client has initialized
+	if (req.Method == "tools/list" || req.Method == "tools/call") && !sess.isInitialized() {
+		response.Error = newMCPError(codeNotInitialized, "Session not initialized: send initialize first", map[string]string{"method": req.Method})
+		return response, invocation
+	}
+
 	switch req.Method {
+	case "ping":
+		sess.touch()
+		response.Result = map[string]interface{}{}
+
+	case "notifications/initialized":
+		// The client confirming the handshake; there is nothing to do
+		response.Result = map[string]interface{}{}
+
+	case "notifications/cancelled":
+		var params struct {
+			RequestID string `json:"requestId"`
+			Reason    string `json:"reason"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.RequestID == "" {
+			response.Error = newMCPError(codeInvalidRequest, "Invalid params: requestId is required", nil)
+			break
+		}
+		if sess.cancelCall(params.RequestID) {
+			log.Printf("[INFO] Cancelled request %s on %s: %s", params.RequestID, sess.id, params.Reason)
+		}
+		response.Result = map[string]interface{}{}
+
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+			ResponseVersion string `json:"response_version"`
+			ClientID        string `json:"client_id"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				response.Error = newMCPError(codeInvalidRequest, "Invalid params", map[string]string{"detail": err.Error()})
+				break
+			}
+		}
+
+		sess.setClientID(params.ClientID)
+
+		// Spec clients announce a protocolVersion and expect content blocks
+		requested := params.ResponseVersion
+		if requested == "" && params.ProtocolVersion != "" {
+			requested = responseVersionContent
+		}
+		version := negotiateResponseVersion(requested)
+		sess.setResponseVersion(version)
+		sess.markInitialized()
+		response.Result = serverInfoResult(version)
+
 	case "tools/list":
 		response.Result = map[string]interface{}{
 			"tools": server.ListTools(),
 		}
 
 	case "tools/call":
-		var invocation ToolInvocation
 		if err := json.Unmarshal(req.Params, &invocation); err != nil {
-			response.Error = &MCPError{Code: -32600, Message: "Invalid params"}
+			response.Error = newMCPError(codeInvalidRequest, "Invalid params", map[string]string{"detail": err.Error()})
 			break
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
+		if !req.isNotification() {
+			defer sess.trackCall(req.ID, cancel)()
+		}
 
 		result := server.ExecuteTool(ctx, invocation)
 
-		if result.IsError {
-			response.Error = &MCPError{Code: -32000, Message: result.Content.(string)}
-		} else {
-			response.Result = result.Content
+		switch {
+		case result.IsError && sess.getResponseVersion() == responseVersionContent:
+			// the error rides in the result, so log it here rather than in sendResponse
+			mcpErr := toMCPError(result.Content)
+			logErrorResponse(sess.id, req, invocation, mcpErr)
+			response.Result = encodeToolError(mcpErr)
+		case result.IsError:
+			response.Error = toMCPError(result.Content)
+		default:
+			response.Result = encodeResult(sess.getResponseVersion(), result.Content)
 		}
 
 		// Update metrics
+		latency := time.Since(start)
 		queriesExecuted.Add(1)
-		totalLatency.Add(time.Since(start).Milliseconds())
+		totalLatency.Add(latency.Milliseconds())
+		clientStats.record(sess.getClientID(), latency.Milliseconds(), result.IsError)
+		server.recordOutcome(invocation.Name, result.IsError)
+
+		log.Printf("[INFO] client=%s tool=%s error=%v duration=%v", sess.getClientID(), invocation.Name, result.IsError, latency)
 
 	default:
-		response.Error = &MCPError{Code: -32601, Message: "Method not found"}
+		response.Error = newMCPError(codeMethodNotFound, "Method not found", map[string]string{"method": req.Method})
 	}
 
-	if err := conn.WriteJSON(response); err != nil {
+	return response, invocation
+}
+
+// describeCall names what req was doing, for messages: the tool for a
+// tool call, otherwise the method
+func describeCall(req MCPRequest, invocation ToolInvocation) string {
+	if invocation.Name != "" {
+		return "tool " + invocation.Name
+	}
+	return req.Method
+}
+
+// sendResponse writes response to the session. Every error response passes
+// through here and is logged with its connection, request and tool.
+// Notifications are never answered, though their errors are still logged.
+func sendResponse(sess *session, req MCPRequest, invocation ToolInvocation, response MCPResponse) {
+	if response.Error != nil {
+		logErrorResponse(sess.id, req, invocation, response.Error)
+	}
+	if req.isNotification() {
+		return
+	}
+	if err := sess.writeJSON(response); err != nil {
 		log.Printf("[ERROR] Failed to send response: %v", err)
 	}
 }
 
-func handleMetrics(w http.ResponseWriter, r *http.Request) {
+// toMCPError converts the content of a failed ToolResult into an MCPError
+func toMCPError(content interface{}) *MCPError {
+	switch c := content.(type) {
+	case *MCPError:
+		return c
+	case error:
+		return newMCPError(codeToolError, c.Error(), nil)
+	default:
+		return newMCPError(codeToolError, fmt.Sprint(c), nil)
+	}
+}
+
+func serverInfoResult(responseVersion string) map[string]interface{} {
+	return map[string]interface{}{
+		"protocolVersion": "0.1.0",
+		"responseVersion": responseVersion,
+		"serverInfo": map[string]string{
+			"name":    "mcp-swiftie-server",
+			"version": "1.0.0",
+		},
+		"capabilities": map[string]interface{}{
+			"tools": map[string]interface{}{},
+		},
+	}
+}
+
+// handleMetrics serves the JSON snapshot, or the Prometheus text format
+// for scrapers that accept text/plain or ask for ?format=prometheus
+func handleMetrics(w http.ResponseWriter, r *http.Request, server *Server) {
+	if r.URL.Query().Get("format") == "prometheus" || strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheusMetrics(w, server)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshotMetrics(server))
+}
+
+// writePrometheusMetrics renders the server metrics in the Prometheus text
+// exposition format. Query latency is a summary (a total and a count)
+// rather than an average, so scrapers can compute rates over any window.
+func writePrometheusMetrics(w io.Writer, server *Server) {
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+
+	metric("queries_executed", "counter", "Tool calls executed since startup.", queriesExecuted.Load())
+
+	fmt.Fprintf(w, "# HELP query_latency_ms Tool call latency in milliseconds.\n# TYPE query_latency_ms summary\n")
+	fmt.Fprintf(w, "query_latency_ms_sum %d\nquery_latency_ms_count %d\n", totalLatency.Load(), queriesExecuted.Load())
+
+	metric("active_goroutines", "gauge", "Requests being handled right now.", activeGoroutines.Load())
+	metric("uptime_seconds", "gauge", "Seconds since the server started.", int64(time.Since(startTime).Seconds()))
+	metric("queue_depth", "gauge", "Requests waiting for a worker.", server.pool.QueueDepth())
+}
+
+func snapshotMetrics(server *Server) Metrics {
 	queries := queriesExecuted.Load()
 	latency := totalLatency.Load()
 
@@ -199,15 +623,73 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 		avgLatency = float64(latency) / float64(queries)
 	}
 
-	metrics := Metrics{
+	return Metrics{
 		QueriesExecuted:  queries,
 		AvgLatencyMS:     avgLatency,
 		ActiveGoroutines: activeGoroutines.Load(),
 		UptimeSeconds:    int64(time.Since(startTime).Seconds()),
+		QueueDepth:       server.pool.QueueDepth(),
+		Clients:          clientStats.snapshot(),
+		Tools:            server.stats.snapshot(),
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(metrics)
+// diffMetrics reports what changed between baseline and current. The window
+// average latency covers only the queries run since the baseline.
+func diffMetrics(baseline, current Metrics) map[string]interface{} {
+	queries := current.QueriesExecuted - baseline.QueriesExecuted
+
+	var windowLatency interface{}
+	if queries > 0 {
+		latency := current.AvgLatencyMS*float64(current.QueriesExecuted) - baseline.AvgLatencyMS*float64(baseline.QueriesExecuted)
+		windowLatency = roundTo(latency/float64(queries), 1)
+	}
+
+	return map[string]interface{}{
+		"window_seconds":          current.UptimeSeconds - baseline.UptimeSeconds,
+		"queries_executed_delta":  queries,
+		"avg_latency_ms_delta":    roundTo(current.AvgLatencyMS-baseline.AvgLatencyMS, 1),
+		"window_avg_latency_ms":   windowLatency,
+		"active_goroutines_delta": current.ActiveGoroutines - baseline.ActiveGoroutines,
+		"baseline":                baseline,
+		"current":                 current,
+	}
+}
+
+// flushMetrics logs the final metrics snapshot and, if url is set, POSTs it
+// there. The POST is time-bounded so a slow collector can't hang shutdown.
+func flushMetrics(metrics Metrics, url string) {
+	log.Printf("[INFO] Final metrics: queries=%d avg_latency_ms=%.1f uptime_seconds=%d",
+		metrics.QueriesExecuted, metrics.AvgLatencyMS, metrics.UptimeSeconds)
+
+	if url == "" {
+		return
+	}
+
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		log.Printf("[ERROR] Failed to encode final metrics: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[ERROR] Invalid METRICS_FLUSH_URL: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("[WARN] Failed to flush final metrics: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	log.Printf("[INFO] Flushed final metrics to %s (%s)", url, resp.Status)
 }
 
 func getToolNames(tools []map[string]interface{}) []string {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	cases := map[string]string{
+		"":            "",
+		"/":           "",
+		"swiftie":     "/swiftie",
+		"/swiftie/":   "/swiftie",
+		" /a/b/ ":     "/a/b",
+		"/swiftie/v1": "/swiftie/v1",
+	}
+	for in, want := range cases {
+		if got := normalizeBasePath(in); got != want {
+			t.Errorf("normalizeBasePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRoutesRespectBasePath(t *testing.T) {
+	ts := httptest.NewServer(newRouter(NewServer(), "/swiftie"))
+	defer ts.Close()
+
+	for path, want := range map[string]int{
+		"/swiftie/health":  http.StatusOK,
+		"/swiftie/metrics": http.StatusOK,
+		"/health":          http.StatusNotFound,
+		"/metrics":         http.StatusNotFound,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestMetricsPrometheusFormat(t *testing.T) {
+	ts := httptest.NewServer(newRouter(NewServer(), ""))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		path, accept string
+	}{
+		{"/metrics?format=prometheus", ""},
+		{"/metrics", "text/plain;version=0.0.4;q=0.5,*/*;q=0.1"},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+tc.path, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", tc.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("%s: expected text/plain, got %s", tc.path, ct)
+		}
+		for _, want := range []string{
+			"# TYPE queries_executed counter\nqueries_executed ",
+			"# TYPE query_latency_ms summary\nquery_latency_ms_sum ",
+			"\nquery_latency_ms_count ",
+			"# TYPE active_goroutines gauge\nactive_goroutines ",
+			"# TYPE uptime_seconds gauge\nuptime_seconds ",
+		} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("%s: expected %q in:\n%s", tc.path, want, body)
+			}
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON by default, got %s", ct)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// renderMarkdownTable renders a query result as a GitHub-flavored markdown
+// table. Cells are padded so the columns line up in plain text, numeric
+// columns are right-aligned, and pipes inside values are escaped.
+func renderMarkdownTable(result *QueryResult) string {
+	rows := result.formattedRows()
+
+	header := make([]string, len(result.Columns))
+	widths := make([]int, len(result.Columns))
+	numeric := make([]bool, len(result.Columns))
+	for i, col := range result.Columns {
+		header[i] = markdownCell(col)
+		widths[i] = max(len(header[i]), 3)
+		numeric[i] = len(rows) > 0
+	}
+
+	cells := make([][]string, len(rows))
+	for r, row := range rows {
+		cells[r] = make([]string, len(result.Columns))
+		for i := range result.Columns {
+			var v interface{}
+			if i < len(row) {
+				v = row[i]
+			}
+			if v != nil && !isNumeric(v) {
+				numeric[i] = false
+			}
+
+			cells[r][i] = markdownCell(cellText(v))
+			widths[i] = max(widths[i], len(cells[r][i]))
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(values []string) {
+		b.WriteString("|")
+		for i, v := range values {
+			pad := strings.Repeat(" ", widths[i]-len(v))
+			if numeric[i] {
+				b.WriteString(" " + pad + v + " |")
+			} else {
+				b.WriteString(" " + v + pad + " |")
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(header)
+
+	separator := make([]string, len(widths))
+	for i, w := range widths {
+		if numeric[i] {
+			separator[i] = strings.Repeat("-", w-1) + ":"
+		} else {
+			separator[i] = strings.Repeat("-", w)
+		}
+	}
+	writeRow(separator)
+
+	for _, row := range cells {
+		writeRow(row)
+	}
+	return b.String()
+}
+
+func cellText(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// markdownCell escapes a value for use inside a table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isNumeric(v interface{}) bool {
+	switch v.(type) {
+	case int, int32, int64, float32, float64, json.Number:
+		return true
+	}
+	return false
+}
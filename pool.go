@@ -0,0 +1,44 @@
+package main
+
+// workerPool runs submitted jobs on a fixed number of goroutines fed by a
+// bounded queue, so a burst of requests applies backpressure instead of
+// spawning unbounded goroutines.
+type workerPool struct {
+	jobs chan func()
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &workerPool{jobs: make(chan func(), queueSize)}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for job := range p.jobs {
+		job()
+	}
+}
+
+// Submit queues job without blocking. It returns false when the queue is full.
+func (p *workerPool) Submit(job func()) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// QueueDepth reports how many jobs are waiting for a worker.
+func (p *workerPool) QueueDepth() int {
+	return len(p.jobs)
+}
@@ -2,56 +2,209 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
 
+// ErrQueryTimeout is returned when a query exceeds the client's timeout.
+var ErrQueryTimeout = errors.New("query timed out")
+
+const (
+	defaultQueryTimeout = 10 * time.Second
+	defaultLatency      = 50 * time.Millisecond
+)
+
 type PrestoClient struct {
 	// Mock in-memory database
 	albums []Album
 	songs  []Song
 	tours  []Tour
+	// When the dataset above was loaded
+	loadedAt time.Time
+
+	// Upper bound on any single query, applied even if the caller's
+	// context has no deadline
+	queryTimeout time.Duration
+	// Simulated network latency per query
+	latency time.Duration
+}
+
+// PrestoOption configures a PrestoClient.
+type PrestoOption func(*PrestoClient)
+
+// WithQueryTimeout sets the default timeout applied to every query.
+func WithQueryTimeout(d time.Duration) PrestoOption {
+	return func(p *PrestoClient) {
+		p.queryTimeout = d
+	}
+}
+
+// withLatency overrides the simulated network latency.
+func withLatency(d time.Duration) PrestoOption {
+	return func(p *PrestoClient) {
+		p.latency = d
+	}
 }
 
-func NewPrestoClient() *PrestoClient {
-	return &PrestoClient{
-		albums: getSwiftAlbums(),
-		songs:  getSwiftSongs(),
-		tours:  getSwiftTours(),
+func NewPrestoClient(opts ...PrestoOption) *PrestoClient {
+	p := &PrestoClient{
+		albums:       getSwiftAlbums(),
+		songs:        getSwiftSongs(),
+		tours:        getSwiftTours(),
+		loadedAt:     time.Now(),
+		queryTimeout: defaultQueryTimeout,
+		latency:      defaultLatency,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
+}
+
+// validate checks the loaded data's referential integrity and returns one
+// message per problem: every song must belong to a loaded album.
+func (p *PrestoClient) validate() []string {
+	albums := p.albumIndex()
+
+	var problems []string
+	for _, song := range p.songs {
+		if _, ok := albums[song.AlbumID]; !ok {
+			problems = append(problems, fmt.Sprintf("song %s (%q) references unknown album %s",
+				song.ID, song.Title, song.AlbumID))
+		}
+	}
+	return problems
+}
+
+// begin bounds ctx by the client's query timeout and waits out the simulated
+// network latency.
+func (p *PrestoClient) begin(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.queryTimeout)
+
+	select {
+	case <-time.After(p.latency):
+		return ctx, cancel, nil
+	case <-ctx.Done():
+		cancel()
+		return ctx, cancel, p.queryError(ctx)
+	}
+}
+
+// enter applies the query timeout and simulated latency to an in-memory
+// analytics call, which needs neither the bounded context nor its cancel
+// once it starts.
+func (p *PrestoClient) enter(ctx context.Context) error {
+	_, cancel, err := p.begin(ctx)
+	cancel()
+	return err
+}
+
+// queryError converts a finished context into the error reported to callers.
+func (p *PrestoClient) queryError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %v", ErrQueryTimeout, p.queryTimeout)
+	}
+	return ctx.Err()
 }
 
 func (p *PrestoClient) Query(ctx context.Context, sql string) (*QueryResult, error) {
 	start := time.Now()
 
-	// Simulate network latency
-	time.Sleep(50 * time.Millisecond)
+	ctx, cancel, err := p.begin(ctx)
+	defer cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := parseQuery(strings.TrimSpace(sql))
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+
+	result, err := p.scanTable(ctx, query.source)
+	if err != nil {
+		return nil, err
+	}
+	if query.join != nil {
+		right, err := p.scanTable(ctx, query.join.table)
+		if err != nil {
+			return nil, err
+		}
+		if result, err = joinResults(query.source, result, query.join, right); err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+	}
+
+	if result, err = applyWhere(result, query.where); err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	grouped := hasAggregates(query.columns) || len(query.groupBy) > 0
+	if grouped {
+		if err := applyAggregates(result, query.columns, query.groupBy); err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+	}
+	if err := applyOrderBy(result, query.orderBy); err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	applyLimit(result, query.limit, query.offset)
+	// projection comes last so ORDER BY can use columns that aren't selected
+	if !grouped {
+		if err := applyProjection(result, query.columns); err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+	}
 
-	// Simple SQL parser (mock)
-	sql = strings.ToLower(strings.TrimSpace(sql))
+	result.QueryTime = time.Since(start)
+	return result, nil
+}
 
+// scanTable returns every row of the table named by source. Simple SQL
+// parser (mock): source is the text after FROM (or the whole statement for
+// SHOW TABLES), so filter values and sort columns can't be mistaken for
+// table names.
+func (p *PrestoClient) scanTable(ctx context.Context, source string) (*QueryResult, error) {
 	var result *QueryResult
-	var err error
 
 	switch {
-	case strings.Contains(sql, "show tables"):
+	case strings.Contains(source, "show tables"):
 		result = p.showTables()
-	case strings.Contains(sql, "albums"):
-		result = p.queryAlbums(ctx, sql)
-	case strings.Contains(sql, "songs"):
-		result = p.querySongs(ctx, sql)
-	case strings.Contains(sql, "tours"):
-		result = p.queryTours(ctx, sql)
+	case strings.Contains(source, "albums"):
+		result = p.queryAlbums(ctx, AlbumFilter{})
+	case strings.Contains(source, "songs"):
+		result = p.querySongs(ctx, SongFilter{})
+	case strings.Contains(source, "tours"):
+		result = p.queryTours(ctx, source)
 	default:
-		err = fmt.Errorf("unsupported query: %s", sql)
+		return nil, fmt.Errorf("unsupported query: %s", source)
 	}
 
-	if result != nil {
-		result.QueryTime = time.Since(start)
+	if result == nil {
+		return nil, p.queryError(ctx)
 	}
+	return result, nil
+}
 
-	return result, err
+// QuerySongs runs a songs query with structured filters applied.
+func (p *PrestoClient) QuerySongs(ctx context.Context, filter SongFilter) (*QueryResult, error) {
+	start := time.Now()
+
+	ctx, cancel, err := p.begin(ctx)
+	defer cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	result := p.querySongs(ctx, filter)
+	if result == nil {
+		return nil, p.queryError(ctx)
+	}
+
+	result.QueryTime = time.Since(start)
+	return result, nil
 }
 
 func (p *PrestoClient) StreamQuery(ctx context.Context, sql string, batchSize int) (<-chan [][]interface{}, <-chan error) {
@@ -62,6 +215,11 @@ func (p *PrestoClient) StreamQuery(ctx context.Context, sql string, batchSize in
 		defer close(rowsChan)
 		defer close(errChan)
 
+		if batchSize < 1 {
+			errChan <- fmt.Errorf("batch size must be positive, got %d", batchSize)
+			return
+		}
+
 		result, err := p.Query(ctx, sql)
 		if err != nil {
 			errChan <- err
@@ -104,10 +262,48 @@ func (p *PrestoClient) showTables() *QueryResult {
 	}
 }
 
-func (p *PrestoClient) queryAlbums(ctx context.Context, sql string) *QueryResult {
-	rows := make([][]interface{}, 0, len(p.albums))
+// AlbumFilter narrows an albums query. Zero-valued fields don't filter.
+type AlbumFilter struct {
+	Era string
+}
+
+// matches reports whether album passes every set filter. Eras compare
+// case-insensitively.
+func (f AlbumFilter) matches(album Album) bool {
+	return f.Era == "" || strings.EqualFold(album.Era, f.Era)
+}
+
+// QueryAlbums runs an albums query with structured filters applied.
+func (p *PrestoClient) QueryAlbums(ctx context.Context, filter AlbumFilter) (*QueryResult, error) {
+	start := time.Now()
 
+	ctx, cancel, err := p.begin(ctx)
+	defer cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	result := p.queryAlbums(ctx, filter)
+	if result == nil {
+		return nil, p.queryError(ctx)
+	}
+
+	result.QueryTime = time.Since(start)
+	return result, nil
+}
+
+func (p *PrestoClient) queryAlbums(ctx context.Context, filter AlbumFilter) *QueryResult {
+	albums := make([]Album, 0, len(p.albums))
 	for _, album := range p.albums {
+		if filter.matches(album) {
+			albums = append(albums, album)
+		}
+	}
+	sort.SliceStable(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+
+	rows := make([][]interface{}, 0, len(albums))
+
+	for _, album := range albums {
 		select {
 		case <-ctx.Done():
 			return nil
@@ -130,10 +326,70 @@ func (p *PrestoClient) queryAlbums(ctx context.Context, sql string) *QueryResult
 	}
 }
 
-func (p *PrestoClient) querySongs(ctx context.Context, sql string) *QueryResult {
-	rows := make([][]interface{}, 0, len(p.songs))
+// SongFilter narrows a songs query. Zero-valued fields are not applied.
+type SongFilter struct {
+	AlbumID       string
+	Era           string
+	MinStreams    int64
+	MinChartPeak  int
+	MaxChartPeak  int
+	MinDuration   int
+	TitleContains string
+}
+
+// matches reports whether song passes every set filter. albums is only
+// consulted when filtering by era.
+func (f SongFilter) matches(song Song, albums map[string]Album) bool {
+	if f.AlbumID != "" && song.AlbumID != f.AlbumID {
+		return false
+	}
+	if f.Era != "" && !strings.EqualFold(albums[song.AlbumID].Era, f.Era) {
+		return false
+	}
+	if song.Streams < f.MinStreams {
+		return false
+	}
+	if f.MinChartPeak > 0 && song.ChartPeak < f.MinChartPeak {
+		return false
+	}
+	if f.MaxChartPeak > 0 && song.ChartPeak > f.MaxChartPeak {
+		return false
+	}
+	if song.Duration < f.MinDuration {
+		return false
+	}
+	if f.TitleContains != "" && !strings.Contains(strings.ToLower(song.Title), strings.ToLower(f.TitleContains)) {
+		return false
+	}
+	return true
+}
+
+func (p *PrestoClient) querySongs(ctx context.Context, filter SongFilter) *QueryResult {
+	var albums map[string]Album
+	if filter.Era != "" {
+		albums = p.albumIndex()
+	}
 
+	songs := make([]Song, 0, len(p.songs))
 	for _, song := range p.songs {
+		if filter.matches(song, albums) {
+			songs = append(songs, song)
+		}
+	}
+
+	// Default to id order so results don't depend on slice order
+	sort.SliceStable(songs, func(i, j int) bool { return songs[i].ID < songs[j].ID })
+
+	// Best chart performers first when filtering on chart position
+	if filter.MinChartPeak > 0 || filter.MaxChartPeak > 0 {
+		sort.SliceStable(songs, func(i, j int) bool {
+			return songs[i].ChartPeak < songs[j].ChartPeak
+		})
+	}
+
+	rows := make([][]interface{}, 0, len(songs))
+
+	for _, song := range songs {
 		select {
 		case <-ctx.Done():
 			return nil
@@ -158,9 +414,13 @@ func (p *PrestoClient) querySongs(ctx context.Context, sql string) *QueryResult
 }
 
 func (p *PrestoClient) queryTours(ctx context.Context, sql string) *QueryResult {
-	rows := make([][]interface{}, 0, len(p.tours))
+	tours := make([]Tour, len(p.tours))
+	copy(tours, p.tours)
+	sort.SliceStable(tours, func(i, j int) bool { return tours[i].ID < tours[j].ID })
+
+	rows := make([][]interface{}, 0, len(tours))
 
-	for _, tour := range p.tours {
+	for _, tour := range tours {
 		select {
 		case <-ctx.Done():
 			return nil
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeoutWithoutCallerDeadline(t *testing.T) {
+	p := NewPrestoClient(WithQueryTimeout(20*time.Millisecond), withLatency(time.Second))
+
+	start := time.Now()
+	_, err := p.Query(context.Background(), "SELECT * FROM songs")
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("expected ErrQueryTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("query ran for %v despite 20ms timeout", elapsed)
+	}
+}
+
+func TestAnalyticsHonourQueryTimeout(t *testing.T) {
+	p := NewPrestoClient(WithQueryTimeout(20*time.Millisecond), withLatency(time.Second))
+
+	start := time.Now()
+	_, err := p.TopSongs(context.Background(), 5, "")
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("expected ErrQueryTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("top songs ran for %v despite 20ms timeout", elapsed)
+	}
+}
+
+func TestQueryWithinTimeout(t *testing.T) {
+	p := NewPrestoClient(WithQueryTimeout(time.Second), withLatency(time.Millisecond))
+
+	result, err := p.Query(context.Background(), "SELECT * FROM albums")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RowCount != len(getSwiftAlbums()) {
+		t.Errorf("expected %d albums, got %d", len(getSwiftAlbums()), result.RowCount)
+	}
+}
+
+func TestCallerCancellationIsNotTimeout(t *testing.T) {
+	p := NewPrestoClient(withLatency(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := p.Query(ctx, "SELECT * FROM tours")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDefaultQueriesOrderByID(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	// Reverse the underlying slices to simulate a reload that reorders them.
+	for i, j := 0, len(p.albums)-1; i < j; i, j = i+1, j-1 {
+		p.albums[i], p.albums[j] = p.albums[j], p.albums[i]
+	}
+	for i, j := 0, len(p.songs)-1; i < j; i, j = i+1, j-1 {
+		p.songs[i], p.songs[j] = p.songs[j], p.songs[i]
+	}
+	for i, j := 0, len(p.tours)-1; i < j; i, j = i+1, j-1 {
+		p.tours[i], p.tours[j] = p.tours[j], p.tours[i]
+	}
+
+	for _, sql := range []string{"SELECT * FROM albums", "SELECT * FROM songs", "SELECT * FROM tours"} {
+		result, err := p.Query(context.Background(), sql)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", sql, err)
+		}
+		for i := 1; i < len(result.Rows); i++ {
+			prev, cur := result.Rows[i-1][0].(string), result.Rows[i][0].(string)
+			if prev >= cur {
+				t.Errorf("%s: rows out of id order at %d: %s before %s", sql, i, prev, cur)
+			}
+		}
+	}
+}
+
+func TestDataVersionIgnoresLoadOrder(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+	before, err := p.DataVersion(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, j := 0, len(p.songs)-1; i < j; i, j = i+1, j-1 {
+		p.songs[i], p.songs[j] = p.songs[j], p.songs[i]
+	}
+	reordered, _ := p.DataVersion(context.Background())
+	if reordered["checksum"] != before["checksum"] {
+		t.Errorf("checksum changed after reordering: %v -> %v", before["checksum"], reordered["checksum"])
+	}
+
+	p.songs[0].Streams++
+	changed, _ := p.DataVersion(context.Background())
+	if changed["version"] == before["version"] {
+		t.Errorf("version %v unchanged after modifying data", before["version"])
+	}
+}
+
+func TestQueryWhereCombinesLikeAndNumericComparison(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	result, err := p.Query(context.Background(),
+		"SELECT * FROM songs WHERE title LIKE '%Love%' AND streams_millions > 1000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// "Lover" matches the pattern but has only 850M streams.
+	if result.RowCount != 1 || result.Rows[0][0] != "SONG001" {
+		t.Fatalf("expected only Love Story (SONG001), got %v", result.Rows)
+	}
+
+	result, err = p.Query(context.Background(),
+		"SELECT * FROM songs WHERE title LIKE '%love%' AND streams_millions >= 850 AND chart_peak <= 10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RowCount != 2 {
+		t.Errorf("expected Love Story and Lover, got %v", result.Rows)
+	}
+}
+
+func TestQueryWhereRejectsBadClauses(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	for _, sql := range []string{
+		"SELECT * FROM songs WHERE popularity > 3",
+		"SELECT * FROM songs WHERE streams_millions > 'lots'",
+		"SELECT * FROM songs WHERE title LIKE '%Love",
+		"SELECT * FROM songs WHERE chart_peak < 5 OR chart_peak > 20",
+	} {
+		if _, err := p.Query(context.Background(), sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestValidateDetectsOrphanSongs(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+	if problems := p.validate(); len(problems) != 0 {
+		t.Fatalf("embedded data should be valid, got %v", problems)
+	}
+
+	p.songs = append(p.songs, Song{ID: "SONG999", AlbumID: "ALB404", Title: "Orphan"})
+
+	problems := p.validate()
+	if len(problems) != 1 {
+		t.Fatalf("expected one problem for the orphan song, got %v", problems)
+	}
+	if !strings.Contains(problems[0], "SONG999") || !strings.Contains(problems[0], "ALB404") {
+		t.Errorf("problem should name the song and missing album, got %q", problems[0])
+	}
+}
+
+func TestAdvancedSongSearchBreaksTitleTiesByID(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+	title := p.songs[0].Title
+	p.songs = append(p.songs,
+		Song{ID: "SONG999", AlbumID: p.songs[0].AlbumID, Title: strings.ToUpper(title)},
+		Song{ID: "SONG998", AlbumID: p.songs[0].AlbumID, Title: strings.ToLower(title)},
+	)
+
+	for _, descending := range []bool{false, true} {
+		result, err := p.AdvancedSongSearch(context.Background(), SongFilter{}, "title", descending)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var ids []interface{}
+		for _, row := range result.Rows {
+			if strings.EqualFold(row[1].(string), title) {
+				ids = append(ids, row[0])
+			}
+		}
+		if len(ids) != 3 || ids[0] != p.songs[0].ID || ids[1] != "SONG998" || ids[2] != "SONG999" {
+			t.Errorf("descending=%v: expected equal titles in ID order, got %v", descending, ids)
+		}
+	}
+}
+
+func TestAdvancedSongSearchValidatesFilters(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	result, err := p.AdvancedSongSearch(context.Background(), SongFilter{AlbumID: "alb005", Era: "pop"}, "title", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RowCount == 0 {
+		t.Error("expected lowercase album_id and era to match 1989's songs")
+	}
+
+	for _, filter := range []SongFilter{{AlbumID: "ALB404"}, {Era: "Poop"}} {
+		var argErr *ArgumentError
+		if _, err := p.AdvancedSongSearch(context.Background(), filter, "title", false); !errors.As(err, &argErr) {
+			t.Errorf("%+v: expected an ArgumentError, got %v", filter, err)
+		}
+	}
+}
+
+func TestSortSongsBreaksTiesByID(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	for _, descending := range []bool{false, true} {
+		result, err := p.SortSongs(context.Background(), "grammy_nominations", descending)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := 1; i < len(result.Rows); i++ {
+			prev, cur := result.Rows[i-1], result.Rows[i]
+			if prev[7] == cur[7] && prev[0].(string) > cur[0].(string) {
+				t.Errorf("descending=%v: tied songs %v and %v out of ID order", descending, prev[0], cur[0])
+			}
+		}
+	}
+}
+
+func TestQueryOrderBy(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	result, err := p.Query(context.Background(), "SELECT * FROM songs ORDER BY streams_millions DESC")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 1; i < len(result.Rows); i++ {
+		if result.Rows[i-1][4].(int64) < result.Rows[i][4].(int64) {
+			t.Fatalf("rows %d and %d out of order: %v, %v", i-1, i, result.Rows[i-1], result.Rows[i])
+		}
+	}
+
+	// Album ascending, then title descending within each album
+	result, err = p.Query(context.Background(), "SELECT * FROM songs ORDER BY album_id, title desc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first := result.Rows[0]; first[1] != "ALB002" || first[2] != "You Belong With Me" {
+		t.Errorf("expected You Belong With Me (ALB002) first, got %v", first)
+	}
+}
+
+func TestQueryOrderByRejectsBadClauses(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	for _, sql := range []string{
+		"SELECT * FROM songs ORDER BY popularity",
+		"SELECT * FROM songs ORDER streams_millions",
+		"SELECT * FROM songs ORDER BY streams_millions,",
+		"SELECT * FROM songs ORDER BY title WHERE chart_peak = 1",
+	} {
+		if _, err := p.Query(context.Background(), sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestQueryLimitOffset(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	for _, tc := range []struct {
+		sql   string
+		want  int
+		first interface{}
+	}{
+		{"SELECT * FROM songs ORDER BY streams_millions DESC LIMIT 3", 3, "SONG005"},
+		{"SELECT * FROM songs ORDER BY streams_millions DESC LIMIT 3 OFFSET 1", 3, "SONG006"},
+		{"SELECT * FROM songs LIMIT 500", 20, "SONG001"},
+		{"SELECT * FROM songs LIMIT 5 OFFSET 18", 2, "SONG019"},
+		{"SELECT * FROM songs OFFSET 20", 0, nil},
+	} {
+		result, err := p.Query(context.Background(), tc.sql)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.sql, err)
+		}
+		if result.RowCount != tc.want || len(result.Rows) != tc.want {
+			t.Errorf("%s: expected %d rows, got %d", tc.sql, tc.want, result.RowCount)
+			continue
+		}
+		if tc.want > 0 && result.Rows[0][0] != tc.first {
+			t.Errorf("%s: expected %v first, got %v", tc.sql, tc.first, result.Rows[0][0])
+		}
+	}
+
+	for _, sql := range []string{
+		"SELECT * FROM songs LIMIT -1",
+		"SELECT * FROM songs LIMIT ten",
+		"SELECT * FROM songs LIMIT 2.5",
+	} {
+		if _, err := p.Query(context.Background(), sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestQueryAggregates(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	result, err := p.Query(context.Background(),
+		"SELECT COUNT(*), SUM(streams_millions), MAX(chart_peak), MIN(title) FROM songs WHERE album_id = 'ALB005'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantColumns := []string{"count", "sum_streams_millions", "max_chart_peak", "min_title"}
+	if strings.Join(result.Columns, ",") != strings.Join(wantColumns, ",") {
+		t.Errorf("expected columns %v, got %v", wantColumns, result.Columns)
+	}
+	if result.RowCount != 1 || len(result.Rows) != 1 {
+		t.Fatalf("expected a single row, got %v", result.Rows)
+	}
+	row := result.Rows[0]
+	if row[0] != 5 || row[1] != int64(9400) || row[2] != 6 || row[3] != "Bad Blood" {
+		t.Errorf("unexpected aggregates %v", row)
+	}
+
+	result, err = p.Query(context.Background(), "SELECT AVG(revenue_millions) FROM tours WHERE year > 2020")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if avg := result.Rows[0][0]; avg != 2000.0 {
+		t.Errorf("expected average revenue 2000, got %v", avg)
+	}
+}
+
+func TestQueryAggregatesRejectBadSelects(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	for _, sql := range []string{
+		"SELECT SUM(title) FROM songs",
+		"SELECT AVG(popularity) FROM songs",
+		"SELECT MEDIAN(streams_millions) FROM songs",
+		"SELECT SUM(*) FROM songs",
+		"SELECT title, COUNT(*) FROM songs",
+	} {
+		if _, err := p.Query(context.Background(), sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestQueryGroupBy(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	result, err := p.Query(context.Background(), "SELECT era, COUNT(*), SUM(sales_millions) FROM albums GROUP BY era")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := [][]interface{}{
+		{"Alternative", 1, int64(4)},
+		{"Country", 2, int64(17)},
+		{"Country Pop", 2, int64(13)},
+		{"Indie Folk", 2, int64(5)},
+		{"Pop", 3, int64(17)},
+		{"Synth Pop", 1, int64(6)},
+	}
+	if strings.Join(result.Columns, ",") != "era,count,sum_sales_millions" {
+		t.Errorf("unexpected columns %v", result.Columns)
+	}
+	if result.RowCount != len(want) {
+		t.Fatalf("expected %d groups, got %v", len(want), result.Rows)
+	}
+	for i, row := range want {
+		for j := range row {
+			if result.Rows[i][j] != row[j] {
+				t.Errorf("group %d: expected %v, got %v", i, row, result.Rows[i])
+				break
+			}
+		}
+	}
+
+	result, err = p.Query(context.Background(),
+		"SELECT album_id, COUNT(*) FROM songs GROUP BY album_id ORDER BY count DESC, album_id LIMIT 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row := result.Rows[0]; row[0] != "ALB005" || row[1] != 5 {
+		t.Errorf("expected 1989 (ALB005) with 5 songs, got %v", row)
+	}
+}
+
+func TestQueryGroupByRejectsUngroupedColumns(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	for _, sql := range []string{
+		"SELECT era, title, COUNT(*) FROM albums GROUP BY era",
+		"SELECT * FROM albums GROUP BY era",
+		"SELECT mood, COUNT(*) FROM albums GROUP BY mood",
+		"SELECT era FROM albums GROUP era",
+	} {
+		if _, err := p.Query(context.Background(), sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestQueryJoin(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	result, err := p.Query(context.Background(),
+		"SELECT * FROM songs JOIN albums ON songs.album_id = albums.id WHERE albums.era = 'Synth Pop' ORDER BY songs.id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	index := make(map[string]int)
+	for i, col := range result.Columns {
+		index[col] = i
+	}
+	for _, col := range []string{"songs.title", "songs.album_id", "albums.id", "albums.title", "albums.era"} {
+		if _, ok := index[col]; !ok {
+			t.Fatalf("expected column %s in %v", col, result.Columns)
+		}
+	}
+	if result.RowCount == 0 {
+		t.Fatal("expected Synth Pop songs")
+	}
+	for _, row := range result.Rows {
+		if row[index["songs.album_id"]] != row[index["albums.id"]] || row[index["albums.era"]] != "Synth Pop" {
+			t.Errorf("row doesn't match the join: %v", row)
+		}
+	}
+
+	// the ON predicate may name the joined table first
+	all, err := p.Query(context.Background(), "SELECT * FROM songs INNER JOIN albums ON albums.id = songs.album_id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if all.RowCount != len(p.songs) {
+		t.Errorf("expected every song to match its album, got %d of %d", all.RowCount, len(p.songs))
+	}
+}
+
+func TestQueryJoinRejectsBadPredicates(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	for _, sql := range []string{
+		"SELECT * FROM songs JOIN albums",
+		"SELECT * FROM songs JOIN albums ON album_id = id",
+		"SELECT * FROM songs JOIN albums ON songs.album_id = songs.id",
+		"SELECT * FROM songs JOIN albums ON songs.album_id < albums.id",
+		"SELECT * FROM songs JOIN moods ON songs.mood = moods.id",
+	} {
+		if _, err := p.Query(context.Background(), sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestQueryProjectsSelectedColumns(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+
+	result, err := p.Query(context.Background(),
+		"SELECT title, streams_millions FROM songs ORDER BY chart_peak, id LIMIT 3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(result.Columns, ",") != "title,streams_millions" {
+		t.Errorf("unexpected columns %v", result.Columns)
+	}
+	for _, row := range result.Rows {
+		if len(row) != 2 {
+			t.Fatalf("expected 2 values per row, got %v", row)
+		}
+		if _, ok := row[0].(string); !ok {
+			t.Errorf("expected a title first, got %v", row)
+		}
+	}
+
+	joined, err := p.Query(context.Background(),
+		"SELECT songs.title, albums.title, albums.era FROM songs JOIN albums ON songs.album_id = albums.id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(joined.Columns, ",") != "songs.title,albums.title,albums.era" || joined.RowCount != len(p.songs) {
+		t.Errorf("unexpected join projection: %v with %d rows", joined.Columns, joined.RowCount)
+	}
+
+	_, err = p.Query(context.Background(), "SELECT title, mood FROM songs")
+	if err == nil || !strings.Contains(err.Error(), `"mood"`) {
+		t.Errorf("expected an error naming the unknown column, got %v", err)
+	}
+}
+
+func TestAlbumLookupsIgnoreIDCase(t *testing.T) {
+	p := NewPrestoClient()
+	ctx := context.Background()
+
+	card, err := p.AlbumCard(ctx, "alb005")
+	if err != nil {
+		t.Fatalf("album_card with a lowercase id: %v", err)
+	}
+	if album, _ := card["album"].(Album); album.ID != "ALB005" {
+		t.Errorf("expected ALB005, got %+v", card["album"])
+	}
+
+	neighbors, err := p.AlbumNeighbors(ctx, "Alb005")
+	if err != nil {
+		t.Fatalf("album_neighbors with a mixed-case id: %v", err)
+	}
+	if album, _ := neighbors["album"].(Album); album.ID != "ALB005" {
+		t.Errorf("expected ALB005, got %+v", neighbors["album"])
+	}
+}
+
+func TestStreamingMomentumShowsItsDivisor(t *testing.T) {
+	p := NewPrestoClient()
+
+	result, err := p.StreamingMomentum(context.Background(), 2024)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Columns[5] != "years_counted" {
+		t.Fatalf("expected years_counted in column 5, got %v", result.Columns)
+	}
+	for _, row := range result.Rows {
+		streams, years, rate := row[4].(int64), row[5].(int), row[6].(float64)
+		if want := 2024 - row[3].(int) + 1; years != want {
+			t.Errorf("%v: expected years_counted %d, got %d", row[0], want, years)
+		}
+		if want := roundTo(math.Min(float64(streams)/float64(years), maxMomentum), 1); rate != want {
+			t.Errorf("%v: streams_per_year %v isn't streams / years_counted (%v)", row[0], rate, want)
+		}
+	}
+}
+
+func TestCareerPhasesMapByEraThenYear(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+	p.albums = append(p.albums, Album{ID: "ALB099", Title: "Unmapped", ReleaseYear: 2015, Era: "Jazz"})
+
+	phaseOf := func(result map[string]interface{}, title string) string {
+		for _, row := range result["phases"].([]map[string]interface{}) {
+			if slices.Contains(row["albums"].([]string), title) {
+				return row["phase"].(string)
+			}
+		}
+		return ""
+	}
+
+	result, err := p.CareerPhases(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := phaseOf(result, "Midnights"); got != "Pop" {
+		t.Errorf("expected Midnights in Pop by its era, got %q", got)
+	}
+	if got := phaseOf(result, "Unmapped"); got != "Pop" {
+		t.Errorf("expected an unmapped 2015 album in Pop by year, got %q", got)
+	}
+
+	result, err = p.CareerPhases(context.Background(), map[string]int{"pop": 2016})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := phaseOf(result, "Unmapped"); got != "Transition" {
+		t.Errorf("expected the unmapped album in Transition once Pop starts in 2016, got %q", got)
+	}
+
+	for _, years := range []map[string]int{{"Disco": 1980}, {"Pop": 2005}} {
+		var argErr *ArgumentError
+		if _, err := p.CareerPhases(context.Background(), years); !errors.As(err, &argErr) {
+			t.Errorf("%v: expected an ArgumentError, got %v", years, err)
+		}
+	}
+}
+
+func TestStyleSplitGenreOverrides(t *testing.T) {
+	p := NewPrestoClient(withLatency(0))
+	albumsIn := func(result map[string]interface{}, group string) []string {
+		return result["groups"].(map[string]interface{})[group].(map[string]interface{})["albums"].([]string)
+	}
+
+	result, err := p.StyleSplit(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if slices.Contains(albumsIn(result, stylePop), "Speak Now") {
+		t.Fatal("Speak Now should not be pop-leaning by default")
+	}
+
+	result, err = p.StyleSplit(context.Background(), map[string]string{"country pop": stylePop, "Synth Pop": styleOther})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Contains(albumsIn(result, stylePop), "Speak Now") {
+		t.Errorf("expected Speak Now to move to %s, got %v", stylePop, albumsIn(result, stylePop))
+	}
+	if !slices.Contains(albumsIn(result, styleOther), "Midnights") {
+		t.Errorf("expected Midnights to move to %s, got %v", styleOther, albumsIn(result, styleOther))
+	}
+
+	var argErr *ArgumentError
+	if _, err := p.StyleSplit(context.Background(), map[string]string{"Pop": "disco"}); !errors.As(err, &argErr) {
+		t.Errorf("expected an ArgumentError for an unknown group, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "context"
+
+// progressFunc receives a partial result from a running tool call
+type progressFunc func(update map[string]interface{})
+
+type progressKey struct{}
+
+// withProgress returns a context whose tool calls deliver their partial
+// results to fn. Transports that can't send anything before the final
+// response simply don't set one.
+func withProgress(ctx context.Context, fn progressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress hands update to the context's progress receiver, if any
+func reportProgress(ctx context.Context, update map[string]interface{}) {
+	if fn, ok := ctx.Value(progressKey{}).(progressFunc); ok {
+		fn(update)
+	}
+}
+
+// progressNotification wraps update as a notifications/progress message
+// for the request identified by token. MCP clients match progress to their
+// request by this token.
+func progressNotification(token string, update map[string]interface{}) MCPNotification {
+	params := make(map[string]interface{}, len(update)+1)
+	for k, v := range update {
+		params[k] = v
+	}
+	params["progressToken"] = token
+	return MCPNotification{JSONRPC: "2.0", Method: "notifications/progress", Params: params}
+}
+
+// streamsProgress reports whether the named tool sends progress updates
+func (s *Server) streamsProgress(name string) bool {
+	tool, ok := s.tools.lookup(name)
+	return ok && tool.streams
+}
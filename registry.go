@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// toolHandler runs one tool invocation against the server
+type toolHandler func(s *Server, ctx context.Context, args map[string]interface{}) ToolResult
+
+// toolSpec declares a tool once: the name and schema advertised by
+// tools/list and the handler tools/call dispatches to.
+type toolSpec struct {
+	name        string
+	description string
+	inputSchema map[string]interface{}
+	handler     toolHandler
+	// streams marks tools that report partial results with reportProgress
+	// while they run
+	streams bool
+}
+
+// definition renders the spec the way tools/list advertises it
+func (t toolSpec) definition() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        t.name,
+		"description": t.description,
+		"inputSchema": t.inputSchema,
+	}
+}
+
+// toolRegistry holds tools keyed by name, remembering the order they were
+// registered in so listings stay stable.
+type toolRegistry struct {
+	order []string
+	tools map[string]toolSpec
+}
+
+func newToolRegistry() *toolRegistry {
+	return &toolRegistry{tools: make(map[string]toolSpec)}
+}
+
+// register adds a tool, rejecting unnamed tools, tools without a handler
+// and names that are already registered.
+func (r *toolRegistry) register(tool toolSpec) error {
+	if tool.name == "" {
+		return fmt.Errorf("tool definition has no name")
+	}
+	if tool.handler == nil {
+		return fmt.Errorf("tool %q has no handler", tool.name)
+	}
+	if _, exists := r.tools[tool.name]; exists {
+		return fmt.Errorf("duplicate tool name %q", tool.name)
+	}
+
+	r.tools[tool.name] = tool
+	r.order = append(r.order, tool.name)
+	return nil
+}
+
+// lookup returns the tool registered under name
+func (r *toolRegistry) lookup(name string) (toolSpec, bool) {
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// names returns the registered tool names in registration order
+func (r *toolRegistry) names() []string {
+	return append([]string(nil), r.order...)
+}
+
+// list returns all tool definitions in registration order
+func (r *toolRegistry) list() []map[string]interface{} {
+	tools := make([]map[string]interface{}, 0, len(r.order))
+	for _, name := range r.order {
+		tools = append(tools, r.tools[name].definition())
+	}
+	return tools
+}
+
+// buildToolRegistry registers every spec, failing on the first invalid or
+// duplicate tool.
+func buildToolRegistry(specs []toolSpec) (*toolRegistry, error) {
+	registry := newToolRegistry()
+	for _, tool := range specs {
+		if err := registry.register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
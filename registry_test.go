@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func noopTool(s *Server, ctx context.Context, args map[string]interface{}) ToolResult {
+	return ToolResult{}
+}
+
+func TestToolRegistryRejectsDuplicateNames(t *testing.T) {
+	specs := []toolSpec{
+		{name: "list_tables", handler: noopTool},
+		{name: "query_songs", handler: noopTool},
+		{name: "list_tables", handler: noopTool},
+	}
+
+	if _, err := buildToolRegistry(specs); err == nil {
+		t.Fatal("expected duplicate tool name to be rejected")
+	}
+}
+
+func TestToolRegistryRejectsMissingHandler(t *testing.T) {
+	if _, err := buildToolRegistry([]toolSpec{{name: "list_tables"}}); err == nil {
+		t.Fatal("expected tool without a handler to be rejected")
+	}
+}
+
+func TestRegistryExposesCurrentToolSet(t *testing.T) {
+	want := []string{
+		"list_tables",
+		"query_albums",
+		"query_songs",
+		"analyze_tours",
+		"streaming_query",
+		"stream_outliers",
+		"songs_in_eras",
+		"tour_projection",
+		"songs_per_year",
+		"album_card",
+		"albums_with_counts",
+		"chart_spread",
+		"streaming_momentum",
+		"sort_songs",
+		"era_overview",
+		"most_prolific_album",
+		"duration_stream_correlation",
+		"tours_with_albums",
+		"stream_concentration",
+		"rank_albums",
+		"era_profile",
+		"grammy_efficiency",
+		"album_neighbors",
+		"chart_streaks",
+		"sales_weighted_era",
+		"advanced_song_search",
+		"tour_vs_sales",
+		"markdown_export",
+		"streams_moving_average",
+		"data_version",
+		"per_album_averages",
+		"premium_tour",
+		"genre_catalog",
+		"hit_probability",
+		"era_vs_era",
+		"top_songs_per_era",
+		"style_split",
+		"song_leaderboards",
+		"career_phases",
+		"album_duration_outliers",
+		"error_stats",
+		"summary_sentence",
+		"streams_per_second",
+		"export_chunk",
+		"schema",
+		"eras_dominance",
+		"underrated_songs",
+		"tour_intensity",
+		"songs_by_popularity_tier",
+		"stream_pareto",
+		"value_density",
+		"metrics_diff",
+		"most_consistent_era",
+		"play_queue",
+		"grammy_by_era",
+		"freshest_songs",
+		"stream_projection",
+		"data_gaps",
+		"query_songs_with_album",
+		"top_songs",
+		"compare_tours",
+	}
+
+	server := NewServer()
+	if got := getToolNames(server.ListTools()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tools/list names:\n got %v\nwant %v", got, want)
+	}
+
+	for _, name := range want {
+		tool, ok := server.tools.lookup(name)
+		if !ok || tool.handler == nil {
+			t.Errorf("tool %s has no registered handler", name)
+		}
+	}
+}
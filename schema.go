@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// tableRowTypes maps each table to the struct its rows are built from. The
+// schema tool reads column names and types straight off these structs, so
+// adding a field to types.go is enough to expose it.
+var tableRowTypes = []struct {
+	table string
+	row   reflect.Type
+}{
+	{"albums", reflect.TypeOf(Album{})},
+	{"songs", reflect.TypeOf(Song{})},
+	{"tours", reflect.TypeOf(Tour{})},
+}
+
+// tableNames lists every table in schema order
+func tableNames() []string {
+	names := make([]string, 0, len(tableRowTypes))
+	for _, t := range tableRowTypes {
+		names = append(names, t.table)
+	}
+	return names
+}
+
+// ColumnSchema describes one column of a table
+type ColumnSchema struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TableSchema lists a table's columns in row order
+type TableSchema struct {
+	Name    string         `json:"name"`
+	Columns []ColumnSchema `json:"columns"`
+}
+
+// tableSchemas derives the schema of every table from its row struct.
+func tableSchemas() ([]TableSchema, error) {
+	schemas := make([]TableSchema, 0, len(tableRowTypes))
+	for _, t := range tableRowTypes {
+		columns, err := structColumns(t.row)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.table, err)
+		}
+		schemas = append(schemas, TableSchema{Name: t.table, Columns: columns})
+	}
+	return schemas, nil
+}
+
+// structColumns lists the JSON-visible fields of t as columns, named by
+// their json tag.
+func structColumns(t reflect.Type) ([]ColumnSchema, error) {
+	columns := make([]ColumnSchema, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			name, _, _ = strings.Cut(tag, ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+		}
+
+		sqlType, err := sqlTypeOf(field.Type.Kind())
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		columns = append(columns, ColumnSchema{Name: name, Type: sqlType})
+	}
+	return columns, nil
+}
+
+// sqlTypeOf maps a Go field kind to the Presto type the column would have
+func sqlTypeOf(kind reflect.Kind) (string, error) {
+	switch kind {
+	case reflect.String:
+		return "varchar", nil
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int, reflect.Int32:
+		return "integer", nil
+	case reflect.Int64:
+		return "bigint", nil
+	case reflect.Float32:
+		return "real", nil
+	case reflect.Float64:
+		return "double", nil
+	}
+	return "", fmt.Errorf("no SQL type for Go kind %s", kind)
+}
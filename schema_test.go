@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// The reflected schema has to agree with the columns the query engine
+// actually returns, or clients bootstrapping from it will be misled.
+func TestSchemaMatchesQueryColumns(t *testing.T) {
+	schemas, err := tableSchemas()
+	if err != nil {
+		t.Fatalf("tableSchemas: %v", err)
+	}
+
+	p := NewPrestoClient()
+	for _, schema := range schemas {
+		result, err := p.Query(context.Background(), "SELECT * FROM "+schema.Name)
+		if err != nil {
+			t.Fatalf("query %s: %v", schema.Name, err)
+		}
+
+		var names []string
+		for _, col := range schema.Columns {
+			names = append(names, col.Name)
+		}
+		if !reflect.DeepEqual(names, result.Columns) {
+			t.Errorf("%s: schema columns %v, query columns %v", schema.Name, names, result.Columns)
+		}
+	}
+}
+
+func TestSchemaColumnTypes(t *testing.T) {
+	schemas, err := tableSchemas()
+	if err != nil {
+		t.Fatalf("tableSchemas: %v", err)
+	}
+
+	types := make(map[string]string)
+	for _, schema := range schemas {
+		for _, col := range schema.Columns {
+			types[schema.Name+"."+col.Name] = col.Type
+		}
+	}
+
+	for column, want := range map[string]string{
+		"albums.title":           "varchar",
+		"albums.sales_millions":  "bigint",
+		"songs.chart_peak":       "integer",
+		"tours.revenue_millions": "double",
+	} {
+		if got := types[column]; got != want {
+			t.Errorf("%s: type %q, want %q", column, got, want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// closeGracePeriod bounds how long we wait to deliver a close frame.
+const closeGracePeriod = time.Second
+
+// writeTimeout bounds how long a single write may stall on a client that
+// has stopped reading.
+const writeTimeout = 10 * time.Second
+
+// session is a single client connection. Responses for one connection are
+// written from several workers, so writes are serialized through writeMu.
+type session struct {
+	// id names the connection in logs
+	id string
+	// conn is nil for sessions that aren't WebSockets, such as stdio
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	// write sends one message; for WebSockets outside of tests it is
+	// conn.WriteJSON under a writeTimeout deadline
+	write func(v interface{}) error
+
+	stateMu         sync.Mutex
+	responseVersion string
+	clientID        string
+	initialized     bool
+	// inFlight cancels running tool calls by request id
+	inFlight map[string]context.CancelFunc
+
+	// outbound holds a slot for every response that has been accepted for
+	// processing but not yet written; see reserveWrite
+	outbound    chan struct{}
+	readsPaused atomic.Bool
+
+	lastActivity atomic.Int64
+	closeOnce    sync.Once
+}
+
+func newSession(conn *websocket.Conn) *session {
+	s := &session{id: uuid.New().String(), conn: conn, outbound: make(chan struct{}, maxPendingWrites)}
+	s.write = func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(v)
+	}
+	s.touch()
+	return s
+}
+
+// newStreamSession is a session that writes each message as a line of JSON
+// to w, for transports without a WebSocket.
+func newStreamSession(w io.Writer) *session {
+	s := &session{id: uuid.New().String(), outbound: make(chan struct{}, maxPendingWrites)}
+	s.write = json.NewEncoder(w).Encode
+	s.touch()
+	return s
+}
+
+func (s *session) setResponseVersion(version string) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.responseVersion = version
+}
+
+func (s *session) getResponseVersion() string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.responseVersion == "" {
+		return responseVersionFlat
+	}
+	return s.responseVersion
+}
+
+// setClientID attributes the session to id. Blank ids are ignored so a
+// header-supplied id isn't wiped by an initialize without one.
+func (s *session) setClientID(id string) {
+	id = normalizeClientID(id)
+	if id == "" {
+		return
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.clientID = id
+}
+
+func (s *session) getClientID() string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.clientID == "" {
+		return defaultClientID
+	}
+	return s.clientID
+}
+
+// markInitialized records a completed initialize handshake
+func (s *session) markInitialized() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.initialized = true
+}
+
+func (s *session) isInitialized() bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.initialized
+}
+
+// trackCall registers cancel as the way to stop the tool call for request
+// id. The returned func unregisters it once the call is over.
+func (s *session) trackCall(id string, cancel context.CancelFunc) func() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.inFlight == nil {
+		s.inFlight = make(map[string]context.CancelFunc)
+	}
+	s.inFlight[id] = cancel
+	return func() {
+		s.stateMu.Lock()
+		defer s.stateMu.Unlock()
+		delete(s.inFlight, id)
+	}
+}
+
+// cancelCall stops the running tool call for request id, reporting whether
+// there was one
+func (s *session) cancelCall(id string) bool {
+	s.stateMu.Lock()
+	cancel, ok := s.inFlight[id]
+	s.stateMu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// progressContext delivers progress from req's tool call to the client as
+// notifications/progress messages, written as they happen. Notifications
+// have no id to report progress against, so they get none.
+func (s *session) progressContext(ctx context.Context, req MCPRequest) context.Context {
+	if req.isNotification() {
+		return ctx
+	}
+	return withProgress(ctx, func(update map[string]interface{}) {
+		if err := s.writeJSON(progressNotification(req.ID, update)); err != nil {
+			log.Printf("[ERROR] Failed to send progress for %s: %v", req.ID, err)
+		}
+	})
+}
+
+// writeJSON sends v, holding the write lock so messages from different
+// workers aren't interleaved. A failed write is not retried: a WebSocket
+// keeps the first write error and fails every later write with it, and a
+// stream may already hold part of the line, so the connection is closed on
+// the first failure instead, since the client would otherwise wait forever
+// for a response that was lost.
+func (s *session) writeJSON(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.write(v)
+	if err != nil {
+		s.goodbye(websocket.CloseInternalServerErr, "write failed")
+	}
+	return err
+}
+
+// reserveWrite claims an outbound slot for a response about to be produced,
+// blocking while maxPendingWrites responses are still waiting to be written.
+// The read loop calls it before dispatching each request, so a client that
+// reads slowly stops having its requests read instead of piling up work.
+func (s *session) reserveWrite() {
+	select {
+	case s.outbound <- struct{}{}:
+		return
+	default:
+	}
+
+	s.readsPaused.Store(true)
+	log.Printf("[WARN] Pausing reads on %s: %d responses waiting to be written", s.id, len(s.outbound))
+	s.outbound <- struct{}{}
+	s.readsPaused.Store(false)
+}
+
+// releaseWrite frees the slot claimed by reserveWrite once the response has
+// been written (or has failed to be).
+func (s *session) releaseWrite() {
+	<-s.outbound
+}
+
+// pendingWrites reports how many accepted responses are not yet written
+func (s *session) pendingWrites() int {
+	return len(s.outbound)
+}
+
+// drainWrites blocks until every response reserved with reserveWrite has
+// been written, by claiming all of the outbound slots.
+func (s *session) drainWrites() {
+	for i := 0; i < cap(s.outbound); i++ {
+		s.outbound <- struct{}{}
+	}
+	for i := 0; i < cap(s.outbound); i++ {
+		<-s.outbound
+	}
+}
+
+// touch records client activity for the idle reaper.
+func (s *session) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (s *session) idleFor() time.Duration {
+	return time.Since(time.Unix(0, s.lastActivity.Load()))
+}
+
+// goodbye sends a close frame with code and reason, then closes the socket,
+// so clients can tell a deliberate close from a network failure. It is safe
+// to call more than once; only the first call has any effect. Sessions
+// without a WebSocket have nothing to close.
+func (s *session) goodbye(code int, reason string) {
+	if s.conn == nil {
+		return
+	}
+	s.closeOnce.Do(func() {
+		msg := websocket.FormatCloseMessage(code, reason)
+		if err := s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeGracePeriod)); err != nil {
+			log.Printf("[WARN] Failed to send close frame: %v", err)
+		}
+		s.conn.Close()
+	})
+}
+
+// reapIdle closes the session once it has been idle for longer than timeout.
+// It returns when done is closed.
+func (s *session) reapIdle(timeout time.Duration, done <-chan struct{}) {
+	interval := timeout / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if s.idleFor() > timeout {
+				log.Printf("[INFO] Closing idle connection from %s (client %s)", s.conn.RemoteAddr(), s.getClientID())
+				s.goodbye(websocket.CloseNormalClosure, "idle timeout")
+				return
+			}
+		}
+	}
+}
+
+// sessionRegistry tracks open sessions so shutdown can say goodbye to each.
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[*session]struct{}
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{sessions: make(map[*session]struct{})}
+}
+
+func (r *sessionRegistry) add(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[s] = struct{}{}
+}
+
+func (r *sessionRegistry) remove(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, s)
+}
+
+// closeAll sends every open session a close frame with code and reason.
+func (r *sessionRegistry) closeAll(code int, reason string) {
+	r.mu.Lock()
+	open := make([]*session, 0, len(r.sessions))
+	for s := range r.sessions {
+		open = append(open, s)
+	}
+	r.mu.Unlock()
+
+	for _, s := range open {
+		s.goodbye(code, reason)
+	}
+}
@@ -0,0 +1,693 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestServer starts an MCP endpoint backed by server and connects to it,
+// consuming the initial server info message.
+func dialTestServer(t *testing.T, server *Server) *websocket.Conn {
+	t.Helper()
+	return dialTestServerWithHeader(t, server, nil)
+}
+
+// dialTestServerWithHeader is dialTestServer with extra handshake headers.
+func dialTestServerWithHeader(t *testing.T, server *Server, header http.Header) *websocket.Conn {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleMCPConnection(w, r, server)
+	}))
+	t.Cleanup(ts.Close)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var info MCPResponse
+	if err := conn.ReadJSON(&info); err != nil {
+		t.Fatalf("failed to read server info: %v", err)
+	}
+	return conn
+}
+
+// expectClose reads until the connection closes and returns the close frame.
+func expectClose(t *testing.T, conn *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("expected close frame, got %v", err)
+		}
+		return closeErr
+	}
+}
+
+func TestShutdownSendsGoingAway(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+
+	sessions.closeAll(websocket.CloseGoingAway, "server shutting down")
+
+	closeErr := expectClose(t, conn)
+	if closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("expected close code %d, got %d", websocket.CloseGoingAway, closeErr.Code)
+	}
+	if closeErr.Text != "server shutting down" {
+		t.Errorf("unexpected close reason %q", closeErr.Text)
+	}
+}
+
+func TestIdleReaperSendsCloseFrame(t *testing.T) {
+	previous := idleTimeout
+	idleTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { idleTimeout = previous })
+
+	conn := dialTestServer(t, NewServer())
+
+	closeErr := expectClose(t, conn)
+	if closeErr.Code != websocket.CloseNormalClosure {
+		t.Errorf("expected close code %d, got %d", websocket.CloseNormalClosure, closeErr.Code)
+	}
+	if closeErr.Text != "idle timeout" {
+		t.Errorf("unexpected close reason %q", closeErr.Text)
+	}
+}
+
+func TestPingReturnsEmptyResult(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+
+	start := time.Now()
+	if err := conn.WriteJSON(MCPRequest{JSONRPC: "2.0", ID: "ping-1", Method: "ping"}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	var resp map[string]interface{}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("ping took %v, expected a prompt reply", elapsed)
+	}
+	if resp["id"] != "ping-1" || resp["error"] != nil {
+		t.Fatalf("unexpected ping response: %v", resp)
+	}
+	if result, ok := resp["result"].(map[string]interface{}); !ok || len(result) != 0 {
+		t.Errorf("expected empty result object, got %v", resp["result"])
+	}
+}
+
+func TestPingKeepsSessionAlive(t *testing.T) {
+	previous := idleTimeout
+	idleTimeout = 150 * time.Millisecond
+	t.Cleanup(func() { idleTimeout = previous })
+
+	conn := dialTestServer(t, NewServer())
+
+	for i := 0; i < 8; i++ {
+		if err := conn.WriteJSON(MCPRequest{JSONRPC: "2.0", ID: "keepalive", Method: "ping"}); err != nil {
+			t.Fatalf("ping %d failed, session was reaped: %v", i, err)
+		}
+		var resp MCPResponse
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("ping %d got no reply, session was reaped: %v", i, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// roundTrip sends req and returns the next response on conn.
+func roundTrip(t *testing.T, conn *websocket.Conn, req MCPRequest) MCPResponse {
+	t.Helper()
+
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var resp MCPResponse
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	return resp
+}
+
+func initializeRequest(params string) MCPRequest {
+	return MCPRequest{JSONRPC: "2.0", ID: "init", Method: "initialize", Params: []byte(params)}
+}
+
+func listTablesRequest(id string) MCPRequest {
+	return MCPRequest{JSONRPC: "2.0", ID: id, Method: "tools/call",
+		Params: []byte(`{"name":"list_tables","arguments":{}}`)}
+}
+
+func TestClientIDAttributesMetrics(t *testing.T) {
+	header := http.Header{"X-Client-Id": []string{"header-client"}}
+	conn := dialTestServerWithHeader(t, NewServer(), header)
+
+	roundTrip(t, conn, initializeRequest(`{}`))
+	roundTrip(t, conn, listTablesRequest("1"))
+
+	roundTrip(t, conn, initializeRequest(`{"client_id":"init-client"}`))
+	roundTrip(t, conn, listTablesRequest("2"))
+
+	clients := clientStats.snapshot()
+	if got := clients["header-client"].QueriesExecuted; got != 1 {
+		t.Errorf("header-client: expected 1 query, got %d", got)
+	}
+	if got := clients["init-client"].QueriesExecuted; got != 1 {
+		t.Errorf("init-client: expected 1 query, got %d", got)
+	}
+}
+
+func TestInitializeRespondsWithServerInfo(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+
+	resp := roundTrip(t, conn, initializeRequest(`{}`))
+	if resp.Error != nil {
+		t.Fatalf("initialize failed: %+v", resp.Error)
+	}
+	if resp.ID != "init" {
+		t.Errorf("expected the response keyed to request id init, got %q", resp.ID)
+	}
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected an object result, got %T", resp.Result)
+	}
+	for _, key := range []string{"protocolVersion", "serverInfo", "capabilities"} {
+		if _, ok := result[key]; !ok {
+			t.Errorf("initialize result is missing %s: %v", key, result)
+		}
+	}
+}
+
+func TestToolsRejectedBeforeInitialize(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+
+	for _, req := range []MCPRequest{
+		{JSONRPC: "2.0", ID: "list", Method: "tools/list"},
+		listTablesRequest("call"),
+	} {
+		resp := roundTrip(t, conn, req)
+		if resp.Error == nil || resp.Error.Code != codeNotInitialized {
+			t.Errorf("%s before initialize: expected error %d, got %+v", req.Method, codeNotInitialized, resp.Error)
+		}
+		if resp.Result != nil {
+			t.Errorf("%s before initialize: expected no result, got %v", req.Method, resp.Result)
+		}
+	}
+}
+
+func TestToolsAllowedAfterInitialize(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+
+	if resp := roundTrip(t, conn, initializeRequest(`{}`)); resp.Error != nil {
+		t.Fatalf("initialize failed: %+v", resp.Error)
+	}
+
+	for _, req := range []MCPRequest{
+		{JSONRPC: "2.0", ID: "list", Method: "tools/list"},
+		listTablesRequest("call"),
+	} {
+		resp := roundTrip(t, conn, req)
+		if resp.Error != nil || resp.Result == nil {
+			t.Errorf("%s after initialize: expected a result, got error %+v", req.Method, resp.Error)
+		}
+	}
+}
+
+func TestFragmentedMessageIsReassembled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleMCPConnection(w, r, NewServer())
+	}))
+	t.Cleanup(ts.Close)
+
+	// A small write buffer makes the client send each message as a text
+	// frame followed by continuation frames of at most 256 bytes.
+	dialer := websocket.Dialer{WriteBufferSize: 256}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var info MCPResponse
+	if err := conn.ReadJSON(&info); err != nil {
+		t.Fatalf("failed to read server info: %v", err)
+	}
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	// Pad a tools/call well past the frame size with a long title filter
+	params := `{"name":"advanced_song_search","arguments":{"title":"` + strings.Repeat("x", 64*1024) + `"}}`
+	resp := roundTrip(t, conn, MCPRequest{JSONRPC: "2.0", ID: "big", Method: "tools/call", Params: []byte(params)})
+
+	if resp.ID != "big" {
+		t.Errorf("expected response to id big, got %q", resp.ID)
+	}
+	if resp.Error != nil {
+		t.Fatalf("fragmented tools/call failed: %+v", resp.Error)
+	}
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok || result["row_count"] != float64(0) {
+		t.Errorf("expected an empty search result, got %v", resp.Result)
+	}
+}
+
+func TestToolErrorRatesAreRecorded(t *testing.T) {
+	server := NewServer()
+	conn := dialTestServer(t, server)
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	roundTrip(t, conn, listTablesRequest("ok"))
+	roundTrip(t, conn, MCPRequest{JSONRPC: "2.0", ID: "bad", Method: "tools/call",
+		Params: []byte(`{"name":"album_card","arguments":{"album_id":"ALB999"}}`)})
+	roundTrip(t, conn, MCPRequest{JSONRPC: "2.0", ID: "good", Method: "tools/call",
+		Params: []byte(`{"name":"album_card","arguments":{"album_id":"ALB005"}}`)})
+
+	stats := server.stats.snapshot()
+	if got := stats["list_tables"]; got.Calls != 1 || got.Errors != 0 {
+		t.Errorf("list_tables: expected 1 call and no errors, got %+v", got)
+	}
+	if got := stats["album_card"]; got.Calls != 2 || got.Errors != 1 || got.ErrorRate != 0.5 {
+		t.Errorf("album_card: expected 2 calls, 1 error, rate 0.5, got %+v", got)
+	}
+}
+
+// findSession returns the open session attributed to clientID.
+func findSession(t *testing.T, clientID string) *session {
+	t.Helper()
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	for s := range sessions.sessions {
+		if s.getClientID() == clientID {
+			return s
+		}
+	}
+	t.Fatalf("no open session for client %s", clientID)
+	return nil
+}
+
+func TestReadsPauseWhileWritesLag(t *testing.T) {
+	previous := maxPendingWrites
+	maxPendingWrites = 2
+	t.Cleanup(func() { maxPendingWrites = previous })
+
+	header := http.Header{"X-Client-Id": []string{"slow-reader"}}
+	conn := dialTestServerWithHeader(t, NewServer(), header)
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	// Holding the write lock stands in for a client that has stopped
+	// reading: every response is stuck waiting to be written.
+	sess := findSession(t, "slow-reader")
+	sess.writeMu.Lock()
+
+	const sent = 6
+	for i := 0; i < sent; i++ {
+		if err := conn.WriteJSON(listTablesRequest(fmt.Sprint(i))); err != nil {
+			sess.writeMu.Unlock()
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !sess.readsPaused.Load() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	paused, pending := sess.readsPaused.Load(), sess.pendingWrites()
+	sess.writeMu.Unlock()
+
+	if !paused {
+		t.Fatal("read loop kept reading while responses were stuck")
+	}
+	if pending != maxPendingWrites {
+		t.Errorf("expected %d pending writes while paused, got %d", maxPendingWrites, pending)
+	}
+
+	// Once the client drains, every request is still answered
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < sent; i++ {
+		var resp MCPResponse
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("response %d: %v", i, err)
+		}
+		if resp.Error != nil {
+			t.Errorf("response %s: unexpected error %+v", resp.ID, resp.Error)
+		}
+	}
+	if sess.readsPaused.Load() {
+		t.Error("reads still paused after the backlog drained")
+	}
+}
+
+// dialRawSession connects to a handler that hands its server-side session
+// to use, and returns the client end.
+func dialRawSession(t *testing.T, use func(*session)) *websocket.Conn {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		use(newSession(conn))
+	}))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestTimedOutWriteClosesConnection(t *testing.T) {
+	errs := make(chan [2]error, 1)
+	attempts := make(chan int, 1)
+	conn := dialRawSession(t, func(sess *session) {
+		n := 0
+		send := sess.write
+		sess.write = func(v interface{}) error {
+			n++
+			// a deadline already passed fails the write the way a client
+			// that stopped reading would once writeTimeout elapsed
+			sess.conn.SetWriteDeadline(time.Now().Add(-time.Second))
+			return sess.conn.WriteJSON(v)
+		}
+		first := sess.writeJSON(MCPResponse{JSONRPC: "2.0", ID: "timed-out"})
+		attempts <- n
+		sess.write = send
+		second := sess.writeJSON(MCPResponse{JSONRPC: "2.0", ID: "after"})
+		errs <- [2]error{first, second}
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err == nil {
+		t.Fatalf("expected the connection to close, got message %s", data)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatalf("connection was left open after a failed write")
+	}
+
+	got := <-errs
+	if got[0] == nil {
+		t.Fatal("write past its deadline reported success")
+	}
+	if got[1] == nil {
+		t.Error("write after a failed write succeeded; the connection should be unusable")
+	}
+	if n := <-attempts; n != 1 {
+		t.Errorf("failed WebSocket write was retried: %d write attempts", n)
+	}
+}
+
+func TestFatalWriteFailureClosesConnection(t *testing.T) {
+	calls := make(chan int, 1)
+	conn := dialRawSession(t, func(sess *session) {
+		n := 0
+		sess.write = func(interface{}) error {
+			n++
+			return websocket.ErrCloseSent
+		}
+		sess.writeJSON(MCPResponse{JSONRPC: "2.0", ID: "lost"})
+		calls <- n
+	})
+
+	closeErr := expectClose(t, conn)
+	if closeErr.Code != websocket.CloseInternalServerErr {
+		t.Errorf("expected close code %d, got %d", websocket.CloseInternalServerErr, closeErr.Code)
+	}
+	if n := <-calls; n != 1 {
+		t.Errorf("fatal error was retried: %d write attempts", n)
+	}
+}
+
+func TestBatchRepliesInRequestOrder(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	batch := []MCPRequest{
+		listTablesRequest("first"),
+		{JSONRPC: "2.0", Method: "notifications/initialized"},
+		{JSONRPC: "2.0", ID: "second", Method: "ping"},
+		{JSONRPC: "2.0", ID: "third", Method: "no/such/method"},
+		listTablesRequest("fourth"),
+	}
+	if err := conn.WriteJSON(batch); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	var replies []MCPResponse
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&replies); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	want := []string{"first", "second", "third", "fourth"}
+	if len(replies) != len(want) {
+		t.Fatalf("expected %d replies (none for the notification), got %+v", len(want), replies)
+	}
+	for i, id := range want {
+		if replies[i].ID != id {
+			t.Errorf("reply %d: expected id %s, got %s", i, id, replies[i].ID)
+		}
+	}
+	if replies[0].Error != nil || replies[2].Error == nil || replies[2].Error.Code != codeMethodNotFound {
+		t.Errorf("unexpected outcomes: %+v", replies)
+	}
+}
+
+func TestEmptyBatchIsInvalid(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(" []")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var resp MCPResponse
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if resp.Error == nil || resp.Error.Code != codeInvalidRequest {
+		t.Errorf("expected %d for an empty batch, got %+v", codeInvalidRequest, resp.Error)
+	}
+}
+
+func TestOversizedBatchIsRejected(t *testing.T) {
+	server := NewServer()
+	server.maxBatchSize = 2
+	conn := dialTestServer(t, server)
+
+	batch := []MCPRequest{
+		{JSONRPC: "2.0", ID: "1", Method: "ping"},
+		{JSONRPC: "2.0", ID: "2", Method: "ping"},
+		{JSONRPC: "2.0", ID: "3", Method: "ping"},
+	}
+	if err := conn.WriteJSON(batch); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var resp MCPResponse
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("expected a single error response: %v", err)
+	}
+	if resp.Error == nil || resp.Error.Code != codeInvalidRequest {
+		t.Fatalf("expected %d for an oversized batch, got %+v", codeInvalidRequest, resp.Error)
+	}
+	data, _ := resp.Error.Data.(map[string]interface{})
+	if data["batch_size"] != float64(3) || data["max_batch_size"] != float64(2) {
+		t.Errorf("expected batch_size 3 and max_batch_size 2, got %v", resp.Error.Data)
+	}
+
+	// the connection is still usable
+	if resp := roundTrip(t, conn, MCPRequest{JSONRPC: "2.0", ID: "after", Method: "ping"}); resp.Error != nil {
+		t.Errorf("ping after a rejected batch failed: %+v", resp.Error)
+	}
+}
+
+func TestNotificationsGetNoResponse(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	for _, req := range []MCPRequest{
+		{JSONRPC: "2.0", Method: "notifications/initialized"},
+		{JSONRPC: "2.0", Method: "no/such/method"},
+		{JSONRPC: "2.0", Method: "tools/call", Params: []byte(`{"name":"list_tables","arguments":{}}`)},
+	} {
+		if err := conn.WriteJSON(req); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	// the first reply on the wire must be for the request that has an id
+	resp := roundTrip(t, conn, MCPRequest{JSONRPC: "2.0", ID: "after", Method: "ping"})
+	if resp.ID != "after" {
+		t.Errorf("expected only the ping to be answered, got a reply for %q: %+v", resp.ID, resp)
+	}
+
+	// nor may one follow once the queued tool call finishes
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	var extra MCPResponse
+	if err := conn.ReadJSON(&extra); err == nil {
+		t.Errorf("expected no reply to the notifications, got %+v", extra)
+	}
+}
+
+func TestContentVersionWrapsToolResults(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+
+	init := roundTrip(t, conn, initializeRequest(`{"protocolVersion":"2024-11-05"}`))
+	if v := init.Result.(map[string]interface{})["responseVersion"]; v != responseVersionContent {
+		t.Fatalf("expected a spec client to get response version %s, got %v", responseVersionContent, v)
+	}
+
+	resp := roundTrip(t, conn, listTablesRequest("ok"))
+	result := resp.Result.(map[string]interface{})
+	blocks := result["content"].([]interface{})
+	block := blocks[0].(map[string]interface{})
+	if result["isError"] != false || block["type"] != "text" || !strings.Contains(block["text"].(string), `"albums"`) {
+		t.Errorf("unexpected content result %v", result)
+	}
+
+	resp = roundTrip(t, conn, MCPRequest{JSONRPC: "2.0", ID: "bad", Method: "tools/call",
+		Params: []byte(`{"name":"query_songs","arguments":{"min_streams":"lots"}}`)})
+	if resp.Error != nil {
+		t.Fatalf("expected the tool error inside the result, got %+v", resp.Error)
+	}
+	result = resp.Result.(map[string]interface{})
+	block = result["content"].([]interface{})[0].(map[string]interface{})
+	if result["isError"] != true || !strings.Contains(block["text"].(string), "min_streams") {
+		t.Errorf("unexpected error result %v", result)
+	}
+}
+
+// readMessage reads the next message on conn as a generic object
+func readMessage(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+
+	var msg map[string]interface{}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	return msg
+}
+
+func streamRequest(id string) MCPRequest {
+	return MCPRequest{JSONRPC: "2.0", ID: id, Method: "tools/call",
+		Params: []byte(`{"name":"streaming_query","arguments":{"table":"songs"}}`)}
+}
+
+func TestStreamingQuerySendsBatchesAsProgress(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	if err := conn.WriteJSON(streamRequest("stream")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	rows := 0
+	for {
+		msg := readMessage(t, conn)
+		if msg["id"] == "stream" {
+			if msg["error"] != nil {
+				t.Fatalf("unexpected error %v", msg["error"])
+			}
+			break
+		}
+		params := msg["params"].(map[string]interface{})
+		if msg["method"] != "notifications/progress" || params["progressToken"] != "stream" {
+			t.Fatalf("expected progress for the stream request, got %v", msg)
+		}
+		rows += len(params["rows"].([]interface{}))
+	}
+	if rows != 20 {
+		t.Errorf("expected all 20 songs across the progress updates, got %d", rows)
+	}
+}
+
+func TestStreamingQueryStopsWhenCancelled(t *testing.T) {
+	conn := dialTestServer(t, NewServer())
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	if err := conn.WriteJSON(streamRequest("stream")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if msg := readMessage(t, conn); msg["method"] != "notifications/progress" {
+		t.Fatalf("expected a first batch, got %v", msg)
+	}
+	cancel := MCPRequest{JSONRPC: "2.0", Method: "notifications/cancelled",
+		Params: []byte(`{"requestId":"stream","reason":"user gave up"}`)}
+	if err := conn.WriteJSON(cancel); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	sawNotice := false
+	for {
+		msg := readMessage(t, conn)
+		if msg["id"] == "stream" {
+			if msg["error"] == nil {
+				t.Errorf("expected the cancelled stream to end in an error, got %v", msg)
+			}
+			break
+		}
+		if params, _ := msg["params"].(map[string]interface{}); params["cancelled"] == true {
+			sawNotice = true
+		}
+	}
+	if !sawNotice {
+		t.Error("expected a cancellation notice before the response")
+	}
+}
+
+func TestPanickingToolGetsInternalError(t *testing.T) {
+	server := NewServer()
+	err := server.tools.register(toolSpec{
+		name: "explode",
+		handler: func(*Server, context.Context, map[string]interface{}) ToolResult {
+			var args map[string]interface{}
+			return ToolResult{Content: args["missing"].(string)}
+		},
+	})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	conn := dialTestServer(t, server)
+	roundTrip(t, conn, initializeRequest(`{}`))
+
+	resp := roundTrip(t, conn, MCPRequest{JSONRPC: "2.0", ID: "boom", Method: "tools/call",
+		Params: []byte(`{"name":"explode","arguments":{}}`)})
+	if resp.Error == nil || resp.Error.Code != codeInternalError || !strings.Contains(resp.Error.Message, "explode") {
+		t.Fatalf("expected %d naming the tool, got %+v", codeInternalError, resp.Error)
+	}
+
+	// the connection survives to serve the next request
+	if resp := roundTrip(t, conn, listTablesRequest("after")); resp.Error != nil {
+		t.Errorf("expected the next request to succeed, got %+v", resp.Error)
+	}
+}
@@ -0,0 +1,984 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The mock engine understands a small slice of SQL on top of a table scan:
+//
+//   - WHERE: comparisons joined by AND. Comparisons are "column op literal"
+//     where op is =, !=, <>, <, <=, >, >= or LIKE, and the literal is a
+//     number or a single-quoted string ('' escapes a quote).
+//   - ORDER BY: comma-separated columns, each optionally ASC or DESC.
+//   - LIMIT n and OFFSET m: the window of rows to return, after sorting.
+//   - Aggregates in the select list: COUNT(*), and COUNT, SUM, AVG, MIN or
+//     MAX of a column. They collapse the filtered rows into a single row,
+//     or one row per group with GROUP BY.
+//   - GROUP BY: comma-separated columns; any plain column in the select list
+//     must be one of them.
+//   - Column lists: "SELECT a, b FROM t" returns only those columns, in
+//     that order; * stands for every column.
+//   - JOIN: "FROM a [INNER] JOIN b ON a.x = b.y" pairs every row of a with
+//     the rows of b whose y equals its x. Joined columns are prefixed with
+//     their table name, e.g. songs.title and albums.title.
+
+type sqlTokenKind int
+
+const (
+	tokIdent sqlTokenKind = iota
+	tokNumber
+	tokString
+	tokOperator
+	tokSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// keyword reports whether t is the (case-insensitive) keyword kw
+func (t sqlToken) keyword(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+// tokenizeSQL splits sql into identifiers, numbers, quoted strings,
+// comparison operators and single-character symbols.
+func tokenizeSQL(sql string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(sql) {
+					return nil, fmt.Errorf("unterminated string starting at position %d", i)
+				}
+				if sql[j] == '\'' {
+					if j+1 < len(sql) && sql[j+1] == '\'' {
+						b.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(sql[j])
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokString, b.String()})
+			i = j + 1
+
+		case isDigit(c) || (c == '-' || c == '.') && i+1 < len(sql) && isDigit(sql[i+1]):
+			j := i + 1
+			for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokNumber, sql[i:j]})
+			i = j
+
+		case isIdentStart(c):
+			// a dot followed by a name continues it, so table-qualified
+			// columns like songs.title are a single identifier
+			j := i + 1
+			for j < len(sql) && (isIdentStart(sql[j]) || isDigit(sql[j]) ||
+				sql[j] == '.' && j+1 < len(sql) && isIdentStart(sql[j+1])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokIdent, sql[i:j]})
+			i = j
+
+		case strings.ContainsRune("<>=!", rune(c)):
+			j := i + 1
+			if j < len(sql) && strings.ContainsRune("<>=", rune(sql[j])) {
+				j++
+			}
+			op := sql[i:j]
+			switch op {
+			case "=", "!=", "<>", "<", "<=", ">", ">=":
+			default:
+				return nil, fmt.Errorf("unknown operator %q", op)
+			}
+			tokens = append(tokens, sqlToken{tokOperator, op})
+			i = j
+
+		default:
+			tokens = append(tokens, sqlToken{tokSymbol, string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// sqlCondition is one "column op literal" comparison from a WHERE clause.
+type sqlCondition struct {
+	column  string
+	op      string
+	text    string
+	number  float64
+	numeric bool
+	pattern *regexp.Regexp
+}
+
+// sqlQuery is the parsed form of the clauses the mock engine understands.
+type sqlQuery struct {
+	// source is the lowercased text naming the table: what follows FROM,
+	// or the whole statement before any clause if there is no FROM. With a
+	// JOIN it is just the first table.
+	source string
+	join   *sqlJoin
+	// columns is the select list; nil when the statement has none
+	columns []sqlSelectItem
+	where   []sqlCondition
+	groupBy []string
+	orderBy []sqlOrder
+	// limit is -1 when there is no LIMIT clause
+	limit  int
+	offset int
+}
+
+// sqlClauses are the keywords that start a clause, in the order they must
+// appear. Two-word keywords are matched on their first word.
+var sqlClauses = []string{"where", "group", "order", "limit", "offset"}
+
+// parseQuery splits sql into its clauses and parses each one.
+func parseQuery(sql string) (*sqlQuery, error) {
+	tokens, err := tokenizeSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	clauses, head, err := splitClauses(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &sqlQuery{source: joinTokens(head), limit: -1}
+	if len(head) > 0 && head[0].keyword("select") {
+		from := -1
+		for i, tok := range head {
+			if tok.keyword("from") {
+				from = i
+				break
+			}
+		}
+		if from < 0 {
+			return nil, fmt.Errorf("expected FROM")
+		}
+		if query.columns, err = parseSelectList(head[1:from]); err != nil {
+			return nil, err
+		}
+		if query.source, query.join, err = parseFrom(head[from+1:]); err != nil {
+			return nil, err
+		}
+	}
+	if tokens, ok := clauses["where"]; ok {
+		if query.where, err = parseWhere(tokens); err != nil {
+			return nil, err
+		}
+	}
+	if tokens, ok := clauses["group"]; ok {
+		if query.groupBy, err = parseGroupBy(tokens); err != nil {
+			return nil, err
+		}
+	}
+	if tokens, ok := clauses["order"]; ok {
+		if query.orderBy, err = parseOrderBy(tokens); err != nil {
+			return nil, err
+		}
+	}
+	if tokens, ok := clauses["limit"]; ok {
+		if query.limit, err = parseCount("LIMIT", tokens); err != nil {
+			return nil, err
+		}
+	}
+	if tokens, ok := clauses["offset"]; ok {
+		if query.offset, err = parseCount("OFFSET", tokens); err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// splitClauses returns the tokens following each clause keyword, and the
+// tokens before the first one.
+func splitClauses(tokens []sqlToken) (map[string][]sqlToken, []sqlToken, error) {
+	clauses := make(map[string][]sqlToken)
+	var head []sqlToken
+	current, last := "", -1
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		rank := -1
+		for r, kw := range sqlClauses {
+			if tok.keyword(kw) {
+				rank = r
+			}
+		}
+		if rank < 0 {
+			if current == "" {
+				head = append(head, tok)
+			} else {
+				clauses[current] = append(clauses[current], tok)
+			}
+			continue
+		}
+
+		if rank <= last {
+			return nil, nil, fmt.Errorf("unexpected %s", strings.ToUpper(tok.text))
+		}
+		current, last = sqlClauses[rank], rank
+		clauses[current] = []sqlToken{}
+
+		if current == "order" || current == "group" {
+			if i+1 >= len(tokens) || !tokens[i+1].keyword("by") {
+				return nil, nil, fmt.Errorf("expected BY after %s", strings.ToUpper(tok.text))
+			}
+			i++
+		}
+	}
+	return clauses, head, nil
+}
+
+// joinTokens is the lowercased text of tokens separated by spaces
+func joinTokens(tokens []sqlToken) string {
+	words := make([]string, len(tokens))
+	for i, tok := range tokens {
+		words[i] = strings.ToLower(tok.text)
+	}
+	return strings.Join(words, " ")
+}
+
+// sqlJoin is the second table of "FROM a JOIN b ON left = right". left and
+// right are table-qualified columns and may name either table.
+type sqlJoin struct {
+	table string
+	left  string
+	right string
+}
+
+// parseFrom reads the tokens after FROM: a table, optionally joined to a
+// second one. Without a JOIN the tokens are returned as text untouched.
+func parseFrom(tokens []sqlToken) (string, *sqlJoin, error) {
+	at := -1
+	for i, tok := range tokens {
+		if tok.keyword("join") {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return joinTokens(tokens), nil, nil
+	}
+
+	left := tokens[:at]
+	if len(left) == 2 && left[1].keyword("inner") {
+		left = left[:1]
+	}
+	if len(left) != 1 || left[0].kind != tokIdent {
+		return "", nil, fmt.Errorf("expected a single table before JOIN")
+	}
+
+	rest := tokens[at+1:]
+	if len(rest) != 5 || rest[0].kind != tokIdent || !rest[1].keyword("on") ||
+		rest[2].kind != tokIdent || rest[3].text != "=" || rest[4].kind != tokIdent {
+		return "", nil, fmt.Errorf("expected JOIN table ON table.column = table.column")
+	}
+	join := &sqlJoin{
+		table: strings.ToLower(rest[0].text),
+		left:  strings.ToLower(rest[2].text),
+		right: strings.ToLower(rest[4].text),
+	}
+	return strings.ToLower(left[0].text), join, nil
+}
+
+// joinResults is the inner join of left (the table named leftName) and
+// right on the join's ON equality. Every column of the result is prefixed
+// with its table name; rows pair in left order, then right order.
+func joinResults(leftName string, left *QueryResult, join *sqlJoin, right *QueryResult) (*QueryResult, error) {
+	columns := make([]string, 0, len(left.Columns)+len(right.Columns))
+	for _, col := range left.Columns {
+		columns = append(columns, leftName+"."+col)
+	}
+	for _, col := range right.Columns {
+		columns = append(columns, join.table+"."+col)
+	}
+
+	index := make(map[string]int, len(columns))
+	for i, col := range columns {
+		index[col] = i
+	}
+	a, ok := index[join.left]
+	if !ok {
+		return nil, fmt.Errorf("unknown join column %q (valid columns: %s)", join.left, strings.Join(columns, ", "))
+	}
+	b, ok := index[join.right]
+	if !ok {
+		return nil, fmt.Errorf("unknown join column %q (valid columns: %s)", join.right, strings.Join(columns, ", "))
+	}
+	if (a < len(left.Columns)) == (b < len(left.Columns)) {
+		return nil, fmt.Errorf("JOIN ON must compare a column of %s with a column of %s", leftName, join.table)
+	}
+
+	rows := make([][]interface{}, 0, len(left.Rows))
+	for _, l := range left.Rows {
+		for _, r := range right.Rows {
+			row := make([]interface{}, 0, len(columns))
+			row = append(append(row, l...), r...)
+			if row[a] != nil && row[b] != nil && compareValues(row[a], row[b]) == 0 {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	return &QueryResult{Columns: columns, Rows: rows, RowCount: len(rows)}, nil
+}
+
+// parseWhere returns the conditions of a WHERE clause
+func parseWhere(tokens []sqlToken) ([]sqlCondition, error) {
+	var conditions []sqlCondition
+	rest := tokens
+	for {
+		cond, n, err := parseCondition(rest)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, cond)
+		rest = rest[n:]
+
+		if len(rest) == 0 {
+			return conditions, nil
+		}
+		if !rest[0].keyword("and") {
+			return nil, fmt.Errorf("expected AND, got %q", rest[0].text)
+		}
+		rest = rest[1:]
+	}
+}
+
+// parseCondition reads one comparison from the front of tokens and reports
+// how many tokens it used.
+func parseCondition(tokens []sqlToken) (sqlCondition, int, error) {
+	if len(tokens) < 3 {
+		return sqlCondition{}, 0, fmt.Errorf("incomplete condition in WHERE clause")
+	}
+
+	column, opTok, value := tokens[0], tokens[1], tokens[2]
+	if column.kind != tokIdent {
+		return sqlCondition{}, 0, fmt.Errorf("expected column name, got %q", column.text)
+	}
+
+	cond := sqlCondition{column: strings.ToLower(column.text)}
+	switch {
+	case opTok.kind == tokOperator:
+		cond.op = opTok.text
+		if cond.op == "<>" {
+			cond.op = "!="
+		}
+	case opTok.keyword("like"):
+		cond.op = "like"
+	default:
+		return sqlCondition{}, 0, fmt.Errorf("expected comparison after %s, got %q", column.text, opTok.text)
+	}
+
+	switch value.kind {
+	case tokString:
+		cond.text = value.text
+	case tokNumber:
+		n, err := strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return sqlCondition{}, 0, fmt.Errorf("invalid number %q", value.text)
+		}
+		cond.number, cond.numeric = n, true
+		cond.text = value.text
+	default:
+		return sqlCondition{}, 0, fmt.Errorf("expected a number or quoted string after %s %s, got %q",
+			column.text, opTok.text, value.text)
+	}
+
+	if cond.op == "like" {
+		if cond.numeric {
+			return sqlCondition{}, 0, fmt.Errorf("LIKE needs a quoted pattern, got %s", value.text)
+		}
+		cond.pattern = likePattern(cond.text)
+	}
+	return cond, 3, nil
+}
+
+// likePattern compiles a SQL LIKE pattern (% and _ wildcards) into an
+// anchored, case-insensitive regexp.
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// applyWhere keeps only the rows of result matching every condition.
+func applyWhere(result *QueryResult, conditions []sqlCondition) (*QueryResult, error) {
+	if len(conditions) == 0 {
+		return result, nil
+	}
+
+	index := make(map[string]int, len(result.Columns))
+	for i, col := range result.Columns {
+		index[col] = i
+	}
+	for _, cond := range conditions {
+		if _, ok := index[cond.column]; !ok {
+			return nil, fmt.Errorf("unknown column %q (valid columns: %s)",
+				cond.column, strings.Join(result.Columns, ", "))
+		}
+	}
+
+	rows := make([][]interface{}, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		keep := true
+		for _, cond := range conditions {
+			ok, err := cond.matches(row[index[cond.column]])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			rows = append(rows, row)
+		}
+	}
+
+	result.Rows = rows
+	result.RowCount = len(rows)
+	return result, nil
+}
+
+// matches compares a row value against the condition. Numbers compare
+// numerically; strings compare case-sensitively except for LIKE.
+func (c sqlCondition) matches(value interface{}) (bool, error) {
+	if value == nil {
+		return false, nil
+	}
+
+	if c.pattern != nil {
+		return c.pattern.MatchString(fmt.Sprint(value)), nil
+	}
+
+	if n, ok := numericValue(value); ok {
+		if !c.numeric {
+			return false, fmt.Errorf("column %s is numeric; compare it with a number, not '%s'", c.column, c.text)
+		}
+		return compareOrdered(n, c.number, c.op), nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return false, fmt.Errorf("column %s can't be compared", c.column)
+	}
+	return compareOrdered(s, c.text, c.op), nil
+}
+
+// numericValue widens the numeric types used in result rows to float64
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func compareOrdered[T float64 | string](a, b T, op string) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// sqlOrder is one sort key from an ORDER BY clause.
+type sqlOrder struct {
+	column     string
+	descending bool
+}
+
+// parseOrderBy reads "column [ASC|DESC], ..." from an ORDER BY clause.
+func parseOrderBy(tokens []sqlToken) ([]sqlOrder, error) {
+	var keys []sqlOrder
+	for len(tokens) > 0 {
+		if tokens[0].kind != tokIdent {
+			return nil, fmt.Errorf("expected column name in ORDER BY, got %q", tokens[0].text)
+		}
+		key := sqlOrder{column: strings.ToLower(tokens[0].text)}
+		tokens = tokens[1:]
+
+		if len(tokens) > 0 && (tokens[0].keyword("asc") || tokens[0].keyword("desc")) {
+			key.descending = tokens[0].keyword("desc")
+			tokens = tokens[1:]
+		}
+		keys = append(keys, key)
+
+		if len(tokens) == 0 {
+			break
+		}
+		if tokens[0].text != "," {
+			return nil, fmt.Errorf("expected , or end of ORDER BY, got %q", tokens[0].text)
+		}
+		tokens = tokens[1:]
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("ORDER BY ends with a comma")
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("ORDER BY needs at least one column")
+	}
+	return keys, nil
+}
+
+// applyOrderBy sorts the rows of result by each key in turn. The sort is
+// stable, so rows that tie on every key keep their existing order.
+func applyOrderBy(result *QueryResult, keys []sqlOrder) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	indexes := make([]int, len(keys))
+	for k, key := range keys {
+		indexes[k] = -1
+		for i, col := range result.Columns {
+			if col == key.column {
+				indexes[k] = i
+			}
+		}
+		if indexes[k] < 0 {
+			return fmt.Errorf("unknown column %q in ORDER BY (valid columns: %s)",
+				key.column, strings.Join(result.Columns, ", "))
+		}
+	}
+
+	sort.SliceStable(result.Rows, func(i, j int) bool {
+		for k, key := range keys {
+			c := compareValues(result.Rows[i][indexes[k]], result.Rows[j][indexes[k]])
+			if c == 0 {
+				continue
+			}
+			if key.descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// compareValues orders two cell values: numbers numerically, strings
+// lexically, and nil before anything else. Mixed types fall back to their
+// text.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if x, ok := numericValue(a); ok {
+		if y, ok := numericValue(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// parseCount reads the single non-negative integer of a LIMIT or OFFSET
+// clause.
+func parseCount(clause string, tokens []sqlToken) (int, error) {
+	if len(tokens) != 1 || tokens[0].kind != tokNumber {
+		return 0, fmt.Errorf("%s needs a single whole number", clause)
+	}
+	n, err := strconv.Atoi(tokens[0].text)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s needs a non-negative whole number, got %s", clause, tokens[0].text)
+	}
+	return n, nil
+}
+
+// applyLimit keeps the window of rows starting at offset, at most limit long
+// (no bound when limit is negative, and a negative offset counts as zero). A
+// window past the end is empty.
+func applyLimit(result *QueryResult, limit, offset int) {
+	rows := result.Rows
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(rows) {
+		rows = [][]interface{}{}
+	} else {
+		rows = rows[offset:]
+	}
+	if limit >= 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+
+	result.Rows = rows
+	result.RowCount = len(rows)
+}
+
+// sqlAggregates are the aggregate functions the select list accepts
+var sqlAggregates = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// sqlSelectItem is one entry of the select list: *, a column, or an
+// aggregate of a column (column is "*" for COUNT(*)).
+type sqlSelectItem struct {
+	fn     string
+	column string
+}
+
+func (it sqlSelectItem) isAggregate() bool {
+	return it.fn != ""
+}
+
+// name is the item's output column: the column itself, or the aggregate
+// prefixed to it, e.g. sum_streams_millions. COUNT(*) is just count.
+func (it sqlSelectItem) name() string {
+	switch {
+	case it.fn == "":
+		return it.column
+	case it.column == "*":
+		return it.fn
+	}
+	return it.fn + "_" + it.column
+}
+
+// parseSelectList reads the comma-separated items between SELECT and FROM.
+func parseSelectList(tokens []sqlToken) ([]sqlSelectItem, error) {
+	var items []sqlSelectItem
+	for len(tokens) > 0 {
+		var item sqlSelectItem
+		switch tok := tokens[0]; {
+		case tok.text == "*":
+			item.column = "*"
+			tokens = tokens[1:]
+
+		case tok.kind == tokIdent && len(tokens) > 1 && tokens[1].text == "(":
+			item.fn = strings.ToLower(tok.text)
+			if !sqlAggregates[item.fn] {
+				return nil, fmt.Errorf("unknown function %s", strings.ToUpper(tok.text))
+			}
+			if len(tokens) < 4 || tokens[3].text != ")" ||
+				!(tokens[2].kind == tokIdent || tokens[2].text == "*" && item.fn == "count") {
+				return nil, fmt.Errorf("%s takes a single column", strings.ToUpper(tok.text))
+			}
+			item.column = strings.ToLower(tokens[2].text)
+			tokens = tokens[4:]
+
+		case tok.kind == tokIdent:
+			item.column = strings.ToLower(tok.text)
+			tokens = tokens[1:]
+
+		default:
+			return nil, fmt.Errorf("expected a column in the select list, got %q", tok.text)
+		}
+		items = append(items, item)
+
+		if len(tokens) == 0 {
+			break
+		}
+		if tokens[0].text != "," {
+			return nil, fmt.Errorf("expected , or FROM after %s, got %q", item.name(), tokens[0].text)
+		}
+		tokens = tokens[1:]
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("select list ends with a comma")
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("empty select list")
+	}
+	return items, nil
+}
+
+// applyProjection narrows result to the columns of the select list. It is
+// a no-op for a bare * (or no select list at all).
+func applyProjection(result *QueryResult, items []sqlSelectItem) error {
+	if len(items) == 0 || len(items) == 1 && items[0].column == "*" {
+		return nil
+	}
+
+	index := make(map[string]int, len(result.Columns))
+	for i, col := range result.Columns {
+		index[col] = i
+	}
+	var picks []int
+	for _, item := range items {
+		if item.column == "*" {
+			for i := range result.Columns {
+				picks = append(picks, i)
+			}
+			continue
+		}
+		i, ok := index[item.column]
+		if !ok {
+			return fmt.Errorf("unknown column %q (valid columns: %s)",
+				item.column, strings.Join(result.Columns, ", "))
+		}
+		picks = append(picks, i)
+	}
+
+	columns := make([]string, len(picks))
+	for j, i := range picks {
+		columns[j] = result.Columns[i]
+	}
+	for r, row := range result.Rows {
+		projected := make([]interface{}, len(picks))
+		for j, i := range picks {
+			projected[j] = row[i]
+		}
+		result.Rows[r] = projected
+	}
+	result.Columns = columns
+	return nil
+}
+
+// hasAggregates reports whether any select item is an aggregate
+func hasAggregates(items []sqlSelectItem) bool {
+	for _, item := range items {
+		if item.isAggregate() {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAggregates replaces the rows of result with one row per group of
+// groupBy values, holding the grouped columns and aggregates the select
+// list asks for. Without groupBy all rows form a single group. Groups are
+// sorted by their grouping values so output is deterministic.
+func applyAggregates(result *QueryResult, items []sqlSelectItem, groupBy []string) error {
+	index := make(map[string]int, len(result.Columns))
+	for i, col := range result.Columns {
+		index[col] = i
+	}
+	unknown := func(column string) error {
+		return fmt.Errorf("unknown column %q (valid columns: %s)", column, strings.Join(result.Columns, ", "))
+	}
+
+	grouped := make(map[string]bool, len(groupBy))
+	keyCols := make([]int, len(groupBy))
+	for k, column := range groupBy {
+		i, ok := index[column]
+		if !ok {
+			return unknown(column)
+		}
+		grouped[column] = true
+		keyCols[k] = i
+	}
+
+	for _, item := range items {
+		switch {
+		case item.column == "*" && !item.isAggregate():
+			return fmt.Errorf("* can't be combined with aggregates or GROUP BY")
+		case !item.isAggregate() && !grouped[item.column]:
+			if _, ok := index[item.column]; !ok {
+				return unknown(item.column)
+			}
+			return fmt.Errorf("column %s must appear inside an aggregate or in GROUP BY", item.column)
+		case item.isAggregate() && item.column != "*":
+			if _, ok := index[item.column]; !ok {
+				return unknown(item.column)
+			}
+		}
+	}
+
+	// Partition rows, remembering each group's first row for its key values
+	var groups [][][]interface{}
+	if len(groupBy) == 0 {
+		groups = [][][]interface{}{result.Rows}
+	} else {
+		position := make(map[string]int)
+		for _, row := range result.Rows {
+			parts := make([]string, len(keyCols))
+			for k, col := range keyCols {
+				parts[k] = fmt.Sprintf("%T:%v", row[col], row[col])
+			}
+			key := strings.Join(parts, "\x00")
+			i, ok := position[key]
+			if !ok {
+				i = len(groups)
+				position[key] = i
+				groups = append(groups, nil)
+			}
+			groups[i] = append(groups[i], row)
+		}
+		sort.SliceStable(groups, func(a, b int) bool {
+			for _, col := range keyCols {
+				if c := compareValues(groups[a][0][col], groups[b][0][col]); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	columns := make([]string, len(items))
+	for i, item := range items {
+		columns[i] = item.name()
+	}
+
+	rows := make([][]interface{}, 0, len(groups))
+	for _, members := range groups {
+		row := make([]interface{}, len(items))
+		for i, item := range items {
+			if !item.isAggregate() {
+				row[i] = members[0][index[item.column]]
+				continue
+			}
+			value, err := aggregate(item, members, index[item.column])
+			if err != nil {
+				return err
+			}
+			row[i] = value
+		}
+		rows = append(rows, row)
+	}
+
+	result.Columns = columns
+	result.Rows = rows
+	result.RowCount = len(rows)
+	return nil
+}
+
+// parseGroupBy reads the comma-separated columns of a GROUP BY clause.
+func parseGroupBy(tokens []sqlToken) ([]string, error) {
+	var columns []string
+	for {
+		if len(tokens) == 0 || tokens[0].kind != tokIdent {
+			return nil, fmt.Errorf("expected column name in GROUP BY")
+		}
+		columns = append(columns, strings.ToLower(tokens[0].text))
+		tokens = tokens[1:]
+
+		if len(tokens) == 0 {
+			return columns, nil
+		}
+		if tokens[0].text != "," {
+			return nil, fmt.Errorf("expected , or end of GROUP BY, got %q", tokens[0].text)
+		}
+		tokens = tokens[1:]
+	}
+}
+
+// aggregate computes item's function over column col of rows. SUM keeps
+// whole numbers whole; AVG, MIN and MAX of no rows are nil.
+func aggregate(item sqlSelectItem, rows [][]interface{}, col int) (interface{}, error) {
+	if item.fn == "count" {
+		if item.column == "*" {
+			return len(rows), nil
+		}
+		n := 0
+		for _, row := range rows {
+			if row[col] != nil {
+				n++
+			}
+		}
+		return n, nil
+	}
+
+	if item.fn == "min" || item.fn == "max" {
+		var best interface{}
+		for _, row := range rows {
+			v := row[col]
+			if v == nil {
+				continue
+			}
+			if c := compareValues(v, best); best == nil || item.fn == "min" && c < 0 || item.fn == "max" && c > 0 {
+				best = v
+			}
+		}
+		return best, nil
+	}
+
+	var sum float64
+	whole := true
+	n := 0
+	for _, row := range rows {
+		v := row[col]
+		if v == nil {
+			continue
+		}
+		f, ok := numericValue(v)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a numeric column; %s is text", strings.ToUpper(item.fn), item.column)
+		}
+		if _, isFloat := v.(float64); isFloat {
+			whole = false
+		}
+		sum += f
+		n++
+	}
+
+	if item.fn == "avg" {
+		if n == 0 {
+			return nil, nil
+		}
+		return sum / float64(n), nil
+	}
+	if whole {
+		return int64(sum), nil
+	}
+	return sum, nil
+}
+
+// sqlQuote renders s as a single-quoted SQL string literal
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
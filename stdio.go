@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+)
+
+// serveStdio runs one MCP session over newline-delimited JSON-RPC: requests
+// are read from in, one per line, and responses written to out the same way.
+// It returns once in is exhausted and every response has been written.
+// Logging must not go to out, or it would corrupt the protocol stream.
+func serveStdio(server *Server, in io.Reader, out io.Writer) error {
+	sess := newStreamSession(out)
+	log.Printf("[INFO] New MCP stdio session %s", sess.id)
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(maxMessageBytes))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		sess.touch()
+
+		// The scanner reuses its buffer, and requests outlive this iteration
+		data := append([]byte(nil), line...)
+		if err := dispatchMessage(sess, data, server); err != nil {
+			log.Printf("[ERROR] Malformed message on stdio session %s: %v", sess.id, err)
+		}
+	}
+
+	sess.drainWrites()
+	log.Printf("[INFO] Stdio session %s closed (client %s)", sess.id, sess.getClientID())
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading stdin: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStdioAnswersEachRequestOnItsOwnLine(t *testing.T) {
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`not json`,
+		`{"jsonrpc":"2.0","id":"call","method":"tools/call","params":{"name":"list_tables","arguments":{}}}`,
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := serveStdio(NewServer(), strings.NewReader(in), &out); err != nil {
+		t.Fatalf("serveStdio failed: %v", err)
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var resp MCPResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("output line isn't a response: %q", scanner.Text())
+		}
+		if resp.Error != nil {
+			t.Errorf("%s: unexpected error %+v", resp.ID, resp.Error)
+		}
+		ids = append(ids, resp.ID)
+	}
+	if strings.Join(ids, ",") != "init,call" {
+		t.Errorf("expected responses to init and call only, got %v", ids)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// unknownToolName buckets calls to tools that aren't registered, so client
+// typos can't grow the stats without bound.
+const unknownToolName = "(unknown)"
+
+// ToolStats counts calls and failures for one tool.
+type ToolStats struct {
+	Calls     int64   `json:"calls"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// toolStats records the outcome of every tools/call by tool name.
+type toolStats struct {
+	mu    sync.Mutex
+	tools map[string]*ToolStats
+}
+
+func newToolStats() *toolStats {
+	return &toolStats{tools: make(map[string]*ToolStats)}
+}
+
+func (t *toolStats) record(tool string, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, ok := t.tools[tool]
+	if !ok {
+		stats = &ToolStats{}
+		t.tools[tool] = stats
+	}
+	stats.Calls++
+	if failed {
+		stats.Errors++
+	}
+}
+
+// snapshot returns a copy of the per-tool stats with error rates filled in
+func (t *toolStats) snapshot() map[string]ToolStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make(map[string]ToolStats, len(t.tools))
+	for name, stats := range t.tools {
+		s := *stats
+		if s.Calls > 0 {
+			s.ErrorRate = roundTo(float64(s.Errors)/float64(s.Calls), 4)
+		}
+		out[name] = s
+	}
+	return out
+}
+
+// errorStatsResult lists every called tool, highest error rate first.
+func errorStatsResult(stats map[string]ToolStats) *QueryResult {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := stats[names[i]], stats[names[j]]
+		if a.ErrorRate != b.ErrorRate {
+			return a.ErrorRate > b.ErrorRate
+		}
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		return names[i] < names[j]
+	})
+
+	rows := make([][]interface{}, 0, len(names))
+	for _, name := range names {
+		s := stats[name]
+		rows = append(rows, []interface{}{name, s.Calls, s.Errors, s.ErrorRate})
+	}
+
+	return &QueryResult{
+		Columns:  []string{"tool", "calls", "errors", "error_rate"},
+		Rows:     rows,
+		RowCount: len(rows),
+	}
+}
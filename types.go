@@ -14,6 +14,12 @@ type MCPRequest struct {
 	Params  json.RawMessage `json:"params,omitempty"`
 }
 
+// isNotification reports whether the request has no id, which JSON-RPC
+// uses for messages that expect no response
+func (r MCPRequest) isNotification() bool {
+	return r.ID == ""
+}
+
 type MCPResponse struct {
 	JSONRPC string      `json:"jsonrpc"`
 	ID      string      `json:"id"`
@@ -21,9 +27,51 @@ type MCPResponse struct {
 	Error   *MCPError   `json:"error,omitempty"`
 }
 
+// MCPNotification is a message from the server that expects no reply, such
+// as a progress update for a running tool call.
+type MCPNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
 type MCPError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *MCPError) Error() string {
+	return e.Message
+}
+
+// JSON-RPC error codes
+const (
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeToolError      = -32000
+	codeServerBusy     = -32001
+	codeNotInitialized = -32002
+)
+
+func newMCPError(code int, message string, data interface{}) *MCPError {
+	return &MCPError{Code: code, Message: message, Data: data}
+}
+
+// ArgumentError reports a missing or invalid tool argument. It is sent as the
+// data of an invalid-params error so clients can react without parsing the
+// message.
+type ArgumentError struct {
+	Argument     string      `json:"argument"`
+	Message      string      `json:"-"`
+	Value        interface{} `json:"value,omitempty"`
+	ValidOptions []string    `json:"valid_options,omitempty"`
+}
+
+func (e *ArgumentError) Error() string {
+	return e.Message
 }
 
 // Tool Types
@@ -71,4 +119,13 @@ type QueryResult struct {
 	Rows      [][]interface{} `json:"rows"`
 	RowCount  int             `json:"row_count"`
 	QueryTime time.Duration   `json:"query_time_ms"`
+	Empty     bool            `json:"empty,omitempty"`
+	Note      string          `json:"note,omitempty"`
+}
+
+// withoutRows drops the row payload, keeping RowCount and Columns for
+// clients that only need the size of a result.
+func (r *QueryResult) withoutRows() *QueryResult {
+	r.Rows = [][]interface{}{}
+	return r
 }